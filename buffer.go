@@ -83,3 +83,31 @@ func (g *gobBuf) Reset() {
 	g.data = g.data[:0]
 	g.pos = 0
 }
+
+// ReadN appends up to n bytes from r to the buffer. The buffer grows as
+// the bytes arrive rather than all at once so a bogus message length can't
+// make it allocate more than is actually there.
+func (g *gobBuf) ReadN(r io.Reader, n uint64) (int, error) {
+	read := 0
+	for uint64(read) < n {
+		chunk := n - uint64(read)
+		if chunk > readChunk {
+			chunk = readChunk
+		}
+		start := len(g.data)
+		g.data = append(g.data, make([]byte, chunk)...)
+		m, err := io.ReadFull(r, g.data[start:])
+		g.data = g.data[:start+m]
+		read += m
+		if err != nil {
+			if err == io.EOF && read > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+// how much ReadN reads at once
+const readChunk = 64 * 1024
@@ -0,0 +1,173 @@
+package degob
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Canonicalize sorts the entries of every map in the Gob's value by their
+// keys using Compare. Maps are sent in whatever order the encoder ranged
+// over them, which changes from run to run, so this is needed for the same
+// values to always display the same way. Everything else about a gob
+// already comes out in a fixed order as long as the Decoder's Naming isn't
+// RandomNames.
+func (g *Gob) Canonicalize() {
+	if g.Value == nil {
+		return
+	}
+	walkValues(g.Value, func(v Value) bool {
+		if m, ok := v.(*mapValue); ok {
+			sort.SliceStable(m.values, func(i, j int) bool {
+				return Compare(m.values[i].key, m.values[j].key) < 0
+			})
+		}
+		return true
+	})
+}
+
+// Compare orders Values, returning -1, 0 or +1 like strings.Compare. Values
+// of different kinds are ordered by Kind and nil comes before everything.
+// Numbers, strings and bytes are ordered the usual way with NaN first, and
+// false before true. Structs, interfaces and opaque values are ordered by
+// their type names first. Structs, slices and arrays are then ordered
+// element by element, as are maps with their entries sorted by key.
+func Compare(a, b Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if c := compareInts(int64(a.Kind()), int64(b.Kind())); c != 0 {
+		return c
+	}
+	switch a.Kind() {
+	case Bool:
+		x, y := a.(BoolValue).Bool(), b.(BoolValue).Bool()
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case Int:
+		return compareInts(a.(IntValue).Int(), b.(IntValue).Int())
+	case Uint:
+		x, y := a.(UintValue).Uint(), b.(UintValue).Uint()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case Float:
+		return compareFloats(a.(FloatValue).Float(), b.(FloatValue).Float())
+	case Complex:
+		x, y := a.(ComplexValue).Complex(), b.(ComplexValue).Complex()
+		if c := compareFloats(real(x), real(y)); c != 0 {
+			return c
+		}
+		return compareFloats(imag(x), imag(y))
+	case Bytes:
+		return bytes.Compare(a.(BytesValue).Bytes(), b.(BytesValue).Bytes())
+	case String:
+		return strings.Compare(a.(StringValue).String(), b.(StringValue).String())
+	case Interface:
+		x, y := a.(InterfaceValue), b.(InterfaceValue)
+		if c := strings.Compare(x.Name(), y.Name()); c != 0 {
+			return c
+		}
+		return Compare(x.Elem(), y.Elem())
+	case Opaque:
+		x, y := a.(OpaqueValue), b.(OpaqueValue)
+		if c := strings.Compare(x.Name(), y.Name()); c != 0 {
+			return c
+		}
+		return bytes.Compare(x.Bytes(), y.Bytes())
+	case Struct:
+		x, y := a.(StructValue), b.(StructValue)
+		if c := strings.Compare(x.Name(), y.Name()); c != 0 {
+			return c
+		}
+		xf, yf := x.Fields(), y.Fields()
+		for i := 0; i < len(xf) && i < len(yf); i++ {
+			if c := strings.Compare(xf[i].Name, yf[i].Name); c != 0 {
+				return c
+			}
+			if c := Compare(xf[i].Value, yf[i].Value); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(xf)), int64(len(yf)))
+	case Slice:
+		x, y := a.(SliceValue), b.(SliceValue)
+		return compareElems(x.Len(), y.Len(), x.Index, y.Index)
+	case Array:
+		x, y := a.(ArrayValue), b.(ArrayValue)
+		return compareElems(x.Len(), y.Len(), x.Index, y.Index)
+	case Map:
+		xe, ye := sortedEntries(a.(MapValue)), sortedEntries(b.(MapValue))
+		for i := 0; i < len(xe) && i < len(ye); i++ {
+			if c := Compare(xe[i].Key, ye[i].Key); c != 0 {
+				return c
+			}
+			if c := Compare(xe[i].Elem, ye[i].Elem); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(xe)), int64(len(ye)))
+	}
+	// nil and unread values are all the same
+	return 0
+}
+
+func compareInts(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(x, y float64) int {
+	xnan, ynan := math.IsNaN(x), math.IsNaN(y)
+	switch {
+	case xnan && ynan:
+		return 0
+	case xnan:
+		return -1
+	case ynan:
+		return 1
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareElems(xn, yn int, x, y func(int) Value) int {
+	for i := 0; i < xn && i < yn; i++ {
+		if c := Compare(x(i), y(i)); c != 0 {
+			return c
+		}
+	}
+	return compareInts(int64(xn), int64(yn))
+}
+
+func sortedEntries(m MapValue) []MapEntry {
+	entries := m.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	return entries
+}
@@ -0,0 +1,77 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	// each is less than the ones after it
+	ordered := []Value{
+		nil,
+		_bool_type(false),
+		_bool_type(true),
+		_int_type(-3),
+		_int_type(2),
+		_uint_type(1),
+		_uint_type(math.MaxUint64),
+		_float_type(math.NaN()),
+		_float_type(-1.5),
+		_float_type(0.5),
+		_complex_type(1 - 1i),
+		_complex_type(1 + 1i),
+		_bytes_type("ab"),
+		_bytes_type("b"),
+		_string_type(""),
+		_string_type("a"),
+		interfaceValue{name: "A", value: _int_type(5)},
+		interfaceValue{name: "B", value: _int_type(1)},
+		&structValue{name: "A", fields: structFields{{name: "X", value: _int_type(2)}}},
+		&structValue{name: "A", fields: structFields{{name: "X", value: _int_type(2)}, {name: "Y", value: _int_type(0)}}},
+		&structValue{name: "A", fields: structFields{{name: "Y", value: _int_type(1)}}},
+		sliceValue{values: []Value{_int_type(1)}},
+		sliceValue{values: []Value{_int_type(1), _int_type(0)}},
+		sliceValue{values: []Value{_int_type(2)}},
+		&mapValue{values: []mapEntry{{key: _string_type("b"), elem: _int_type(1)}, {key: _string_type("a"), elem: _int_type(9)}}},
+		&mapValue{values: []mapEntry{{key: _string_type("b"), elem: _int_type(0)}}},
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			expected := compareInts(int64(i), int64(j))
+			if c := Compare(a, b); c != expected {
+				t.Errorf("Compare(%d, %d) = %d, expected %d", i, j, c, expected)
+			}
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	m := make(map[string]int)
+	for i := 0; i < 26; i++ {
+		m[string(rune('z'-i))] = i
+	}
+	var first string
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+			t.Fatal(err)
+		}
+		gobs, err := NewDecoder(&buf).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		gobs[0].Canonicalize()
+		out := gobs[0].Display(SingleLine)
+		if i == 0 {
+			first = out
+		} else if out != first {
+			t.Fatalf("expected\n%s\ngot\n%s", first, out)
+		}
+	}
+	if !strings.HasPrefix(first, `map[string]int64{"a": 25, "b": 24, "c": 23, `) {
+		t.Fatal("map isn't sorted", first)
+	}
+}
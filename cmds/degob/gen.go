@@ -0,0 +1,18 @@
+package main
+
+import (
+	"io"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// gen writes a Go file with all of the types in the gobs
+func gen(out io.Writer, gobs []*degob.Gob) {
+	pkg := *pkgName
+	if pkg == "" {
+		pkg = "main"
+	}
+	if err := degob.WriteSource(out, pkg, gobs...); err != nil {
+		errorf("failed to generate source: %v\n", err)
+	}
+}
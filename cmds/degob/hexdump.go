@@ -0,0 +1,19 @@
+package main
+
+import (
+	"io"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// hexdump writes every gob's bytes with what they were decoded as
+func hexdump(out io.Writer, gobs []*degob.Gob) {
+	w := writer{w: out}
+	for i, g := range gobs {
+		w.writeComment("// Gob %d\n", i+1)
+		if err := g.WriteHexdump(w); err != nil {
+			errorf("error writing hexdump: %v\n", err)
+		}
+		w.writeComment("\n")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strconv"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// index lists the messages in the input file without decoding them, or
+// decodes only the ones asked for
+func index(out io.Writer, args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	typ := fs.Int("type", 0, "decode every value of type `id`")
+	fs.Parse(args)
+	if *inFile == "" || *base64d || *base64urld {
+		errorf("index needs a plain -ifile to read from\n")
+	}
+	f, err := os.Open(*inFile)
+	if err != nil {
+		errorf("failed to open `%s` for reading: %v\n", *inFile, err)
+	}
+	defer f.Close()
+	// a file that was cut short still has the messages before that
+	ix, ixErr := degob.NewIndex(f, decoderOptions()...)
+
+	var msgs []int
+	for _, arg := range fs.Args() {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			errorf("bad message number %q\n", arg)
+		}
+		msgs = append(msgs, n)
+	}
+	if *typ != 0 {
+		msgs = append(msgs, ix.Values(degob.TypeID(*typ))...)
+	}
+
+	w := writer{w: out}
+	if len(msgs) == 0 {
+		w.writeStr("%6s  %-8s  %8s  %-5s  %5s  %s\n", "msg", "offset", "len", "kind", "type", "session")
+		for i, m := range ix.Messages {
+			kind := "value"
+			if m.Def {
+				kind = "def"
+			}
+			w.writeStr("%6d  %08x  %8d  %-5s  %5d  %d\n", i, m.Offset, m.Len, kind, int(m.TypeID), m.Session)
+		}
+	} else {
+		gobs := make([]*degob.Gob, 0, len(msgs))
+		for _, n := range msgs {
+			g, err := ix.Decode(n)
+			if err != nil {
+				errorf("failed to decode message %d: %s\n", n, err)
+			}
+			gobs = append(gobs, g)
+		}
+		display(w, gobs)
+	}
+	if ixErr != nil {
+		errorf("failed to index gobs: %s\n", ixErr)
+	}
+}
@@ -20,9 +20,33 @@ var (
 	noComments  = flag.Bool("nc", false, "don't print additional comments")
 	noTypes     = flag.Bool("nt", false, "don't print type information")
 	json        = flag.Bool("json", false, "show value as json")
-	pkgName     = flag.String("pkg", "", "include a package definition in the output with the given name")
+	pkgName     = flag.String("pkg", "", "include a package definition in the output with the given name (gen uses main by default)")
+	infer       = flag.Bool("infer", false, "use the values of all of the gobs to suggest narrower number types")
+	lenient     = flag.Bool("lenient", false, "keep the gobs decoded before an error and as much of the value it happened in as was read")
+	typesFile   = flag.String("types", "", "start off knowing the types in this file, from -savetypes or a capture with them in it")
+	saveTypes   = flag.String("savetypes", "", "write the types that were defined to this file for -types")
+	guess       = flag.Bool("guess", false, "guess what values of types that were never defined are instead of failing")
+	names       = flag.String("names", "context", "how to name anonymous structs: context, id, random, sequential or hash")
+	hintsFile   = flag.String("hints", "", "rename types and fields and narrow field types as `file` says")
+	schemaDir   = flag.String("schema", "", "use the types declared by the Go package in `dir` where they match")
+	seed        = flag.Int64("seed", 0, "use random names with this seed")
+	strict      = flag.Bool("strict", false, "fail on input that encoding/gob wouldn't have written")
 )
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: degob [flags] [command [args]]\n\n")
+	fmt.Fprintf(out, "Without a command the gobs are printed. Commands:\n")
+	fmt.Fprintf(out, "  set [-n gob] path=value...\tchange values and write the gobs back out\n")
+	fmt.Fprintf(out, "  gen\t\t\t\twrite a Go file declaring the types (-pkg sets the package)\n")
+	fmt.Fprintf(out, "  verify\t\t\tcheck degob decodes the same values as encoding/gob\n")
+	fmt.Fprintf(out, "  hexdump\t\t\tshow the bytes of each gob labelled with what they are\n")
+	fmt.Fprintf(out, "  trace\t\t\t\tshow everything the decoder reads as it reads it\n")
+	fmt.Fprintf(out, "  index [-type id] [msg...]\tlist the messages in -ifile or decode only the ones given\n")
+	fmt.Fprintf(out, "  textconv file\t\t\tprint the gobs in file the same way every time, for git diff\n\n")
+	flag.PrintDefaults()
+}
+
 func errorf(s string, v ...interface{}) {
 	_, _ = fmt.Fprintf(os.Stderr, s, v...)
 	os.Exit(1)
@@ -47,7 +71,7 @@ func getWriter() io.WriteCloser {
 
 func getReader() io.ReadCloser {
 	if *inFile != "" {
-		f, err := os.Open(*outFile)
+		f, err := os.Open(*inFile)
 		if err != nil {
 			errorf("failed to open `%s` for reading: %v\n", *inFile, err)
 		}
@@ -79,12 +103,13 @@ func (w writer) writeComment(s string, v ...interface{}) {
 
 func (w writer) writeStr(s string, v ...interface{}) {
 	if w.err != nil {
-		errorf("error writing output: %v\n")
+		errorf("error writing output: %v\n", w.err)
 	}
 	_, w.err = fmt.Fprintf(w.w, s, v...)
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	out := getWriter()
 	defer out.Close()
@@ -97,13 +122,148 @@ func main() {
 		in = ioutil.NopCloser(base64.NewDecoder(base64.URLEncoding, in))
 	}
 
-	w := writer{w: out}
+	// verify, trace, index and textconv decode the input themselves
+	switch flag.Arg(0) {
+	case "verify":
+		verify(out, in)
+		return
+	case "trace":
+		trace(out, in)
+		return
+	case "index":
+		index(out, flag.Args()[1:])
+		return
+	case "textconv":
+		textconv(out, flag.Args()[1:])
+		return
+	}
+
+	opts := decoderOptions()
+	if flag.Arg(0) == "hexdump" {
+		opts = append(opts, degob.WithSpans())
+	}
+	dec := degob.NewDecoder(in, opts...)
+	var gobs []*degob.Gob
+	var err error
+	if *lenient {
+		gobs, err = dec.DecodeLenient()
+	} else {
+		gobs, err = dec.Decode()
+	}
+	// the types are worth having even from a capture that was cut short
+	if *saveTypes != "" {
+		writeTypes(dec.Types())
+	}
+	if err != nil && !*lenient {
+		errorf("failed to decode gob: %s\n", err)
+	}
+
+	if *infer {
+		corpus := degob.NewCorpus()
+		for _, g := range gobs {
+			corpus.Add(g)
+		}
+		for _, g := range gobs {
+			corpus.Apply(g)
+		}
+	}
 
-	dec := degob.NewDecoder(in)
-	gobs, err := dec.Decode()
+	switch flag.Arg(0) {
+	case "":
+		display(writer{w: out}, gobs)
+	case "set":
+		set(out, gobs, flag.Args()[1:])
+	case "gen":
+		gen(out, gobs)
+	case "hexdump":
+		hexdump(out, gobs)
+	default:
+		errorf("unknown command %q\n", flag.Arg(0))
+	}
+	// lenient output is written before the error
 	if err != nil {
 		errorf("failed to decode gob: %s\n", err)
 	}
+}
+
+var namings = map[string]degob.Naming{
+	"id":         degob.IDNames,
+	"random":     degob.RandomNames,
+	"sequential": degob.SequentialNames,
+	"hash":       degob.HashNames,
+	"context":    degob.ContextNames,
+}
+
+// decoderOptions loads -types, -hints and -schema and sets -guess, -names, -seed and
+// -strict
+func decoderOptions() []degob.Option {
+	naming, ok := namings[*names]
+	if !ok {
+		errorf("unknown -names %q\n", *names)
+	}
+	opts := []degob.Option{degob.WithNaming(naming)}
+	if *seed != 0 {
+		opts = append(opts, degob.WithNamingSeed(*seed))
+	}
+	if *guess {
+		opts = append(opts, degob.WithGuessing())
+	}
+	if *strict {
+		opts = append(opts, degob.WithStrict())
+	}
+	if *hintsFile != "" {
+		f, err := os.Open(*hintsFile)
+		if err != nil {
+			errorf("failed to open `%s` for reading: %v\n", *hintsFile, err)
+		}
+		hints, err := degob.ReadHints(f)
+		f.Close()
+		if err != nil {
+			errorf("failed to read hints from `%s`: %s\n", *hintsFile, err)
+		}
+		opts = append(opts, degob.WithHints(hints))
+	}
+	if *schemaDir != "" {
+		schema, err := degob.ParseSchema(*schemaDir)
+		if err != nil {
+			errorf("failed to read the schema from `%s`: %s\n", *schemaDir, err)
+		}
+		opts = append(opts, degob.WithSchema(schema))
+	}
+	if *typesFile == "" {
+		return opts
+	}
+	f, err := os.Open(*typesFile)
+	if err != nil {
+		errorf("failed to open `%s` for reading: %v\n", *typesFile, err)
+	}
+	defer f.Close()
+	types, err := degob.ReadTypeTable(f)
+	if err != nil {
+		if len(types) == 0 {
+			errorf("failed to read types from `%s`: %s\n", *typesFile, err)
+		}
+		fmt.Fprintf(os.Stderr, "using the %d types read from `%s` before: %s\n", len(types), *typesFile, err)
+	}
+	return append(opts, degob.WithTypes(types))
+}
+
+// writeTypes writes -savetypes
+func writeTypes(types degob.TypeTable) {
+	f, err := os.Create(*saveTypes)
+	if err != nil {
+		errorf("failed to open `%s` for writing: %v\n", *saveTypes, err)
+	}
+	if err := types.Encode(f); err != nil {
+		errorf("failed to write types: %v\n", err)
+	}
+	if err := f.Close(); err != nil {
+		errorf("failed to write types: %v\n", err)
+	}
+}
+
+func display(w writer, gobs []*degob.Gob) {
+	var err error
 	if *pkgName != "" {
 		w.writeStr("package %s\n\n", *pkgName)
 	}
@@ -116,6 +276,9 @@ func main() {
 				errorf("error writing types: %v\n", err)
 			}
 		}
+		if g.Partial {
+			w.writeComment("// Partial value, the rest couldn't be read\n")
+		}
 		w.writeComment("// Value: ")
 		if *json {
 			err = g.WriteValue(w, degob.JSON)
@@ -125,6 +288,12 @@ func main() {
 		if err != nil {
 			errorf("error writing values: %v\n", err)
 		}
+		if len(g.Guesses) > 0 {
+			w.writeComment("\n// Guessed")
+			for _, guess := range g.Guesses {
+				w.writeComment("\n//   %s %s, %s confidence", guess.Path, guess.Kind, guess.Confidence)
+			}
+		}
 		w.writeComment("\n// End gob %d\n\n", i+1)
 	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"io"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// set changes values in the decoded gobs and writes all of them back out
+// as a gob stream
+func set(out io.Writer, gobs []*degob.Gob, args []string) {
+	fs := flag.NewFlagSet("set", flag.ExitOnError)
+	n := fs.Int("n", 0, "only change gob number `n` (starting at 1, 0 changes all of them)")
+	b64 := fs.Bool("b64", false, "base64 output")
+	b64url := fs.Bool("b64url", false, "base64url output")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		errorf("set needs at least one path=value\n")
+	}
+	if *n < 0 || *n > len(gobs) {
+		errorf("there are only %d gobs\n", len(gobs))
+	}
+
+	for i, g := range gobs {
+		if *n != 0 && i+1 != *n {
+			continue
+		}
+		for _, expr := range fs.Args() {
+			if err := g.SetExpr(expr); err != nil {
+				errorf("gob %d: %v\n", i+1, err)
+			}
+		}
+	}
+
+	var wc io.WriteCloser
+	switch {
+	case *b64:
+		wc = base64.NewEncoder(base64.StdEncoding, out)
+	case *b64url:
+		wc = base64.NewEncoder(base64.URLEncoding, out)
+	}
+	if wc != nil {
+		out = wc
+	}
+	enc := degob.NewEncoder(out)
+	for i, g := range gobs {
+		if err := enc.Encode(g); err != nil {
+			errorf("failed to encode gob %d: %v\n", i+1, err)
+		}
+	}
+	if wc != nil {
+		if err := wc.Close(); err != nil {
+			errorf("error writing output: %v\n", err)
+		}
+	}
+}
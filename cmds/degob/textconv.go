@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// textconv prints the gobs in a file the same way every time so git can
+// diff them. A file that can't be decoded still shows what could be, with
+// the error at the end, since failing would stop the whole diff.
+func textconv(out io.Writer, args []string) {
+	if len(args) != 1 {
+		errorf("textconv needs exactly one file\n")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		errorf("failed to open `%s` for reading: %v\n", args[0], err)
+	}
+	defer f.Close()
+	gobs, err := degob.NewDecoder(f, decoderOptions()...).DecodeLenient()
+	for _, g := range gobs {
+		g.Canonicalize()
+	}
+	w := writer{w: out}
+	display(w, gobs)
+	if err != nil {
+		w.writeStr("// Error: %s\n", err)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// trace writes everything the decoder reads as it reads it so it still shows
+// how far a broken gob got
+func trace(out io.Writer, in io.Reader) {
+	dec := degob.NewDecoder(in, append(decoderOptions(), degob.WithTrace(out))...)
+	if _, err := dec.Decode(); err != nil {
+		errorf("failed to decode gob: %s\n", err)
+	}
+}
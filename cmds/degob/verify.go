@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gitlab.com/drosseau/degob"
+)
+
+// verify exits with an error if degob and encoding/gob disagree about
+// anything in the input
+func verify(out io.Writer, in io.Reader) {
+	res, err := degob.VerifyRegistering(in)
+	if err != nil {
+		errorf("failed to verify: %v\n", err)
+	}
+	for _, m := range res.Mismatches {
+		fmt.Fprintln(out, m)
+	}
+	skipped := make([]int, 0, len(res.Skipped))
+	for i := range res.Skipped {
+		skipped = append(skipped, i)
+	}
+	sort.Ints(skipped)
+	for _, i := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped gob %d: %v\n", i+1, res.Skipped[i])
+	}
+	if len(res.Mismatches) > 0 {
+		errorf("found %d mismatches, please report them as a degob bug\n", len(res.Mismatches))
+	}
+	fmt.Fprintf(os.Stderr, "encoding/gob agrees with degob on %d gobs\n", res.Checked)
+}
@@ -0,0 +1,335 @@
+package degob
+
+import (
+	"fmt"
+	"go/token"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Corpus collects the values of the numeric struct fields of many gobs so
+// narrower types can be suggested for them. The numbers in fields that are
+// unnamed slices, arrays or maps of numbers count too, so a []int64 field
+// can become a []int32. gobs don't say how big a number
+// was so everything is decoded as an int64, uint64, float64 or complex128,
+// but after enough samples the range of values that turn up is a good guess
+// at what the type really was.
+//
+// Fields are tracked by the name of their struct. Anonymous structs are
+// tracked by their type ID because their names are made up.
+type Corpus struct {
+	fields map[corpusField]*numberStats
+}
+
+type corpusField struct {
+	typ   string
+	field string
+}
+
+// NewCorpus returns an empty Corpus
+func NewCorpus() *Corpus {
+	return &Corpus{fields: make(map[corpusField]*numberStats)}
+}
+
+// Add adds the values of every numeric struct field in the Gob along with
+// the elements and map values of fields holding numbers
+func (c *Corpus) Add(g *Gob) {
+	if g.Value == nil {
+		return
+	}
+	walkValues(g.Value, func(v Value) bool {
+		sv, ok := v.(*structValue)
+		if !ok {
+			return true
+		}
+		w := g.Types[sv.id]
+		if w == nil || w.StructT == nil {
+			return true
+		}
+		typ := corpusTypeName(w.StructT)
+		for _, f := range w.StructT.Field {
+			id, expr, ok := numberType(g.Types, f.Id)
+			if !ok {
+				continue
+			}
+			fv, ok := sv.Field(f.Name)
+			if !ok {
+				continue
+			}
+			key := corpusField{typ: typ, field: f.Name}
+			stats, ok := c.fields[key]
+			if !ok {
+				stats = &numberStats{id: id, expr: expr}
+				c.fields[key] = stats
+			}
+			addNumbers(stats, fv)
+		}
+		return true
+	})
+}
+
+// numberType returns the number type held by a field of type id, looking
+// through unnamed slices, arrays and maps to their elements. expr is the
+// field's type with %s where the number type goes.
+func numberType(types map[TypeID]*WireType, id TypeID) (TypeID, string, bool) {
+	switch id {
+	case IntID, UintID, FloatID, ComplexID:
+		return id, "%s", true
+	}
+	w := types[id]
+	// a named type keeps its name
+	if w == nil || token.IsIdentifier(w.Common().Name) {
+		return 0, "", false
+	}
+	var prefix string
+	switch {
+	case w.SliceT != nil:
+		prefix, id = "[]", w.SliceT.Elem
+	case w.ArrayT != nil:
+		prefix, id = fmt.Sprintf("[%d]", w.ArrayT.Len), w.ArrayT.Elem
+	case w.MapT != nil:
+		prefix, id = "map["+strings.ReplaceAll(w.MapT.KeyTypeString, "%", "%%")+"]", w.MapT.Elem
+	default:
+		return 0, "", false
+	}
+	num, expr, ok := numberType(types, id)
+	return num, prefix + expr, ok
+}
+
+// addNumbers adds v or the elements and map values inside it to stats
+func addNumbers(stats *numberStats, v Value) {
+	switch v.Kind() {
+	case Slice:
+		s := v.(SliceValue)
+		for i := 0; i < s.Len(); i++ {
+			addNumbers(stats, s.Index(i))
+		}
+	case Array:
+		a := v.(ArrayValue)
+		for i := 0; i < a.Len(); i++ {
+			addNumbers(stats, a.Index(i))
+		}
+	case Map:
+		for _, e := range v.(MapValue).Entries() {
+			addNumbers(stats, e.Elem)
+		}
+	default:
+		stats.add(v)
+	}
+}
+
+func corpusTypeName(st *StructType) string {
+	if st.anonymous {
+		return fmt.Sprintf("Anon%d", st.Id)
+	}
+	return st.Name
+}
+
+// Suggestion is a narrower type for a struct field
+type Suggestion struct {
+	// Type and Field are the struct and field the suggestion is for
+	Type  string
+	Field string
+	// Was is the type that was decoded and Suggested is the narrower one
+	Was       string
+	Suggested string
+	// Samples is the number of values seen and Min and Max are the range
+	// they were in. Min and Max are empty for complex numbers.
+	Samples  int
+	Min, Max string
+	// Note has anything else worth knowing about the values
+	Note string
+}
+
+// Confidence is low, medium or high depending on the number of samples the
+// suggestion is based on
+func (s Suggestion) Confidence() string {
+	switch {
+	case s.Samples >= 1000:
+		return "high"
+	case s.Samples >= 50:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Comment describes the suggestion for the type output
+func (s Suggestion) Comment() string {
+	c := fmt.Sprintf("was %s, %d samples", s.Was, s.Samples)
+	if s.Min != "" {
+		c += fmt.Sprintf(" from %s to %s", s.Min, s.Max)
+	}
+	c += fmt.Sprintf(", %s confidence", s.Confidence())
+	if s.Note != "" {
+		c += ", " + s.Note
+	}
+	return c
+}
+
+// Suggest returns a suggestion for each field that could have a narrower
+// type, sorted by type and field
+func (c *Corpus) Suggest() []Suggestion {
+	var sugs []Suggestion
+	for key, stats := range c.fields {
+		sug, ok := stats.suggest()
+		if !ok {
+			continue
+		}
+		sug.Type = key.typ
+		sug.Field = key.field
+		sugs = append(sugs, sug)
+	}
+	sort.Slice(sugs, func(i, j int) bool {
+		if sugs[i].Type != sugs[j].Type {
+			return sugs[i].Type < sugs[j].Type
+		}
+		return sugs[i].Field < sugs[j].Field
+	})
+	return sugs
+}
+
+// Apply changes the TypeString of the struct fields in the Gob's types to
+// the suggested types and describes the suggestion in their Comment. Both
+// WriteTypes and WriteSource use the narrower types afterwards. Only this
+// Gob's types change since every Gob has its own.
+func (c *Corpus) Apply(g *Gob) {
+	sugs := make(map[corpusField]Suggestion)
+	for _, s := range c.Suggest() {
+		sugs[corpusField{typ: s.Type, field: s.Field}] = s
+	}
+	for _, w := range g.Types {
+		if w.StructT == nil {
+			continue
+		}
+		typ := corpusTypeName(w.StructT)
+		for _, f := range w.StructT.Field {
+			s, ok := sugs[corpusField{typ: typ, field: f.Name}]
+			if !ok {
+				continue
+			}
+			f.TypeString = s.Suggested
+			f.Comment = s.Comment()
+			// WriteSource only narrows plain numbers by itself
+			if !narrowerType(f.Id, s.Suggested) && f.hint == nil {
+				f.hint = &goType{expr: s.Suggested}
+			}
+		}
+	}
+}
+
+type numberStats struct {
+	id      TypeID
+	expr    string // the field's type with %s for id
+	samples int
+	// ints and uints
+	min, max int64
+	umax     uint64
+	// floats
+	fmin, fmax float64
+	notFloat32 bool
+	notBool    bool // something other than 0 or 1 was seen
+}
+
+func (s *numberStats) add(v Value) {
+	first := s.samples == 0
+	s.samples++
+	switch v := v.(type) {
+	case IntValue:
+		i := v.Int()
+		if first || i < s.min {
+			s.min = i
+		}
+		if first || i > s.max {
+			s.max = i
+		}
+		s.notBool = s.notBool || (i != 0 && i != 1)
+	case UintValue:
+		u := v.Uint()
+		if u > s.umax {
+			s.umax = u
+		}
+		s.notBool = s.notBool || u > 1
+	case FloatValue:
+		f := v.Float()
+		if first || f < s.fmin {
+			s.fmin = f
+		}
+		if first || f > s.fmax {
+			s.fmax = f
+		}
+		s.notFloat32 = s.notFloat32 || !isFloat32(f)
+	case ComplexValue:
+		c := v.Complex()
+		s.notFloat32 = s.notFloat32 || !isFloat32(real(c)) || !isFloat32(imag(c))
+	}
+}
+
+// float32s are widened to float64s exactly
+func isFloat32(f float64) bool {
+	return math.IsNaN(f) || float64(float32(f)) == f
+}
+
+func (s *numberStats) suggest() (Suggestion, bool) {
+	sug := Suggestion{Was: fmt.Sprintf(s.expr, s.id.name()), Samples: s.samples}
+	switch s.id {
+	case IntID:
+		sug.Min, sug.Max = fmt.Sprint(s.min), fmt.Sprint(s.max)
+		switch {
+		case s.min >= math.MinInt8 && s.max <= math.MaxInt8:
+			sug.Suggested = "int8"
+		case s.min >= math.MinInt16 && s.max <= math.MaxInt16:
+			sug.Suggested = "int16"
+		case s.min >= math.MinInt32 && s.max <= math.MaxInt32:
+			sug.Suggested = "int32"
+		}
+	case UintID:
+		sug.Min, sug.Max = "0", fmt.Sprint(s.umax)
+		switch {
+		case s.umax <= math.MaxUint8:
+			sug.Suggested = "uint8"
+			sug.Note = "might be a byte"
+		case s.umax <= math.MaxUint16:
+			sug.Suggested = "uint16"
+		case s.umax <= math.MaxUint32:
+			sug.Suggested = "uint32"
+		}
+	case FloatID:
+		sug.Min, sug.Max = fmt.Sprint(s.fmin), fmt.Sprint(s.fmax)
+		if !s.notFloat32 {
+			sug.Suggested = "float32"
+		}
+	case ComplexID:
+		if !s.notFloat32 {
+			sug.Suggested = "complex64"
+		}
+	}
+	if (s.id == IntID || s.id == UintID) && !s.notBool {
+		// a real bool would have been sent as one so it is still a number
+		sug.Note = "only ever 0 or 1 so it might be used as a bool"
+	}
+	if sug.Suggested == "" {
+		return sug, false
+	}
+	sug.Suggested = fmt.Sprintf(s.expr, sug.Suggested)
+	return sug, true
+}
+
+// narrowerType reports whether name is a narrower type that values of the
+// builtin type id can be decoded into
+func narrowerType(id TypeID, name string) bool {
+	switch id {
+	case IntID:
+		return name == "int" || name == "int8" || name == "int16" || name == "int32"
+	case UintID:
+		return name == "uint" || name == "uint8" || name == "byte" || name == "uint16" || name == "uint32" || name == "uintptr"
+	case FloatID:
+		return name == "float32"
+	case ComplexID:
+		return name == "complex64"
+	case BytesID:
+		return name == "json.RawMessage"
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+type CorpusSample struct {
+	Small   int
+	Byte    uint
+	Big     int
+	Ratio   float64
+	Precise float64
+	Flag    int
+	Wide    complex128
+}
+
+func corpusGobsTest(n int, t *testing.T) []*Gob {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for i := 0; i < n; i++ {
+		s := CorpusSample{
+			Small:   i - 5,
+			Byte:    uint(i * 2),
+			Big:     i * 100000,
+			Ratio:   float64(i) / 4,
+			Precise: float64(i) / 10,
+			Flag:    i % 2,
+			Wide:    complex(float64(i), 0.5),
+		}
+		if err := enc.Encode(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gobs
+}
+
+func TestCorpusSuggest(t *testing.T) {
+	gobs := corpusGobsTest(100, t)
+	c := NewCorpus()
+	for _, g := range gobs {
+		c.Add(g)
+	}
+	var got []string
+	for _, s := range c.Suggest() {
+		got = append(got, s.Type+"."+s.Field+" "+s.Suggested)
+	}
+	cmp(strings.Join(got, ", "), "CorpusSample.Big int32, CorpusSample.Byte uint8, CorpusSample.Flag int8, CorpusSample.Ratio float32, CorpusSample.Small int8, CorpusSample.Wide complex64", t)
+
+	sugs := c.Suggest()
+	cmp(sugs[1].Comment(), "was uint64, 100 samples from 0 to 198, medium confidence, might be a byte", t)
+	cmp(sugs[2].Note, "only ever 0 or 1 so it might be used as a bool", t)
+	cmp(sugs[4].Min+" "+sugs[4].Max, "-5 94", t)
+}
+
+func TestCorpusApply(t *testing.T) {
+	gobs := corpusGobsTest(10, t)
+	c := NewCorpus()
+	for _, g := range gobs {
+		c.Add(g)
+	}
+	c.Apply(gobs[0])
+	var buf bytes.Buffer
+	if err := gobs[0].WriteTypes(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\tSmall int8 // was int64, 10 samples from -5 to 4, low confidence\n") {
+		t.Fatalf("expected Small to be narrowed in:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := WriteSource(&buf, "gobs", gobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Small   int8 ", "Precise float64\n", "Wide    complex64 "} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, buf.String())
+		}
+	}
+}
+
+type CorpusContainers struct {
+	Scores []int64
+	Counts map[string]uint
+	Grid   [2][3]float64
+}
+
+func TestCorpusContainers(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for i := 0; i < 10; i++ {
+		s := CorpusContainers{
+			Scores: []int64{int64(-i), int64(i * 10)},
+			Counts: map[string]uint{"a": uint(i), "b": uint(i * 1000)},
+			Grid:   [2][3]float64{{0.5, float64(i)}, {0.25}},
+		}
+		if err := enc.Encode(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCorpus()
+	for _, g := range gobs {
+		c.Add(g)
+	}
+	var got []string
+	for _, s := range c.Suggest() {
+		got = append(got, s.Field+" "+s.Was+" "+s.Suggested)
+	}
+	cmp(strings.Join(got, ", "), "Counts map[string]uint64 map[string]uint16, Grid [2][3]float64 [2][3]float32, Scores []int64 []int8", t)
+
+	c.Apply(gobs[0])
+	buf.Reset()
+	if err := WriteSource(&buf, "gobs", gobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Scores []int8 ", "Counts map[string]uint16 ", "Grid   [2][3]float32 "} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, buf.String())
+		}
+	}
+	// the other gobs keep their own types
+	buf.Reset()
+	if err := gobs[1].WriteTypes(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "int8") {
+		t.Fatalf("Apply changed another gob's types:\n%s", buf.String())
+	}
+}
@@ -2,36 +2,14 @@ package degob
 
 import (
 	"bufio"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 )
 
-// keep track of things we've named already so anonymous types don't get the
-// same name somehow
-var anonTypes map[string]struct{} = nil
-
-func init() {
-	if os.Getenv("DEGOB_NORAND") == "" {
-		anonTypes = make(map[string]struct{})
-		if seed := os.Getenv("DEGOB_SEED"); seed != "" {
-			s, err := strconv.ParseInt(seed, 10, 64)
-			if err != nil {
-				panic(fmt.Errorf("Tried to use custom seed %s which cannot be parsed to int64: %v", seed, err))
-			}
-			rand.Seed(s)
-		} else {
-			rand.Seed(time.Now().UnixNano())
-		}
-	}
-}
-
 // This is a gob
 // (byteCount (-type id, encoding of a wireType)* (type id, encoding of a value))*
 
@@ -46,15 +24,53 @@ const (
 // used to stream using DecodeStream or just decode a reader containing
 // any number of Gobs
 type Decoder struct {
-	r              io.Reader // The base reader
-	gobBuf         gobBuf    // Holds the current gob
-	buf            [9]byte   // a buffer for reading uints
-	seenTypes      map[typeId]*WireType
+	r              io.Reader            // The base reader
+	src            io.Reader            // what r is reading from
+	gobBuf         gobBuf               // Holds the current gob
+	buf            [9]byte              // a buffer for reading uints
+	seenTypes      map[TypeID]*WireType // every type defined in the current encoder session
+	gobTypes       map[TypeID]*WireType // types used by the gob currently being decoded
+	gobDefs        []TypeID             // types defined since the last value
+	naming         map[TypeID]bool      // unnamed types getName is writing out
+	zeroing        map[TypeID]bool      // types valueForWireType is filling in
+	opts           DecoderOptions
+	alloc          int64 // bytes allocated for the current gob
 	decodedValue   Value
+	h              Handler      // what the values are read into
+	tree           *treeBuilder // the Handler that makes decodedValue
+	quiet          int          // how deep in a subtree h didn't want
+	guess          bool         // guess values of undefined types, see WithGuessing
+	guesses        []Guess      // what was guessed in the current gob
+	names          Naming       // how anonymous structs are named, see WithNaming
+	strict         bool         // see WithStrict
+	hints          *Hints
+	tableTypes     bool // the session's types came from WithTypes
 	bytesProcessed uint64
 
-	err     *Error
-	inValue bool // are we currently reading a value? this is for streaming errors
+	err      *Error
+	inValue  bool // are we currently reading a value? this is for streaming errors
+	done     bool // nothing more can be read from the stream
+	skipping bool // types were lost so messages are dropped until a value
+
+	// where the decoder is, for errors and Trace
+	messages int     // messages read by getGobPiece
+	typeID   TypeID  // the type being read
+	frames   []frame // where in the types and values the decoder is
+
+	// what each range of bytes meant, only kept WithSpans or WithTrace
+	recordSpans bool
+	trace       io.Writer
+	spans       []Span
+	raw         []byte // every message of the current gob
+	msgStart    int    // where the message in gobBuf starts in raw
+	last        int    // where the last uint read starts in raw
+	streamPos   int64  // bytes read from r by getGobPiece
+	truncated   bool   // the message in gobBuf was cut short
+	gobOffset   int64  // where the current gob starts in the stream
+
+	namingState
+
+	schema *Schema // see WithSchema
 }
 
 type gobType uint8
@@ -64,19 +80,42 @@ const (
 	typeGob
 )
 
-// NewDecoder returns a ready to use decoder for the underlying Reader
-func NewDecoder(r io.Reader) *Decoder {
+// NewDecoder returns a ready to use decoder for the underlying Reader with
+// any Options applied
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
 	dec := new(Decoder)
+	dec.src = r
 	dec.r = bufio.NewReader(r)
-	dec.seenTypes = make(map[typeId]*WireType)
-	dec.decodedValue = nil
+	dec.opts = DefaultDecoderOptions()
+	dec.tree = &treeBuilder{dec: dec}
+	dec.h = dec.tree
+	dec.resetTypes()
+	dec.clearGob()
+	for _, opt := range opts {
+		opt(dec)
+	}
 	return dec
 }
 
 // Decode reads all data on the input reader and decodes the Gobs returning
 // a slice of `Gob`s. This
 func (dec *Decoder) Decode() ([]*Gob, error) {
+	gobs, err := dec.DecodeLenient()
+	if err != nil {
+		return nil, err
+	}
+	return gobs, nil
+}
+
+// DecodeLenient is Decode for damaged input like truncated captures. When
+// there is an error it still returns every Gob decoded before it. If the
+// error was in a value the last Gob has as much of it as could be read with
+// Unread values for the rest and Partial set. The error is an *Error saying
+// which message, type and path it happened at.
+func (dec *Decoder) DecodeLenient() ([]*Gob, error) {
 	dec.bytesProcessed = 0
+	dec.streamPos = 0
+	dec.messages = 0
 	dec.clearGob()
 	gobs := make([]*Gob, 0, 5)
 	for {
@@ -85,11 +124,11 @@ func (dec *Decoder) Decode() ([]*Gob, error) {
 			if dec.err.Err == io.EOF {
 				break
 			}
-			return nil, dec.err
+			return dec.partialGobs(gobs), dec.err
 		}
 		dec.decodeGobPiece()
 		if dec.err != nil {
-			return nil, dec.err
+			return dec.partialGobs(gobs), dec.err
 		}
 
 		// we read the value of one of the input gobs and now we're on
@@ -104,10 +143,45 @@ func (dec *Decoder) Decode() ([]*Gob, error) {
 	return gobs, nil
 }
 
+// partialGobs locates the error and adds the value that was being read when
+// it happened to gobs
+func (dec *Decoder) partialGobs(gobs []*Gob) []*Gob {
+	dec.locateErr()
+	if !dec.inValue || dec.decodedValue == nil {
+		return gobs
+	}
+	g := &Gob{Partial: true}
+	dec.setGob(g)
+	return append(gobs, g)
+}
+
+// locateErr adds where the decoder was to the error. Frames aren't left
+// after an error so they are still where it happened.
+func (dec *Decoder) locateErr() {
+	if dec.err == nil {
+		return
+	}
+	dec.err.Message = dec.messages - 1
+	dec.err.TypeID = dec.typeID
+	dec.err.Path = dec.state()
+}
+
 func (dec *Decoder) setGob(g *Gob) {
 	g.Value = dec.decodedValue
-	if len(dec.seenTypes) > 0 {
-		for _, t := range dec.seenTypes {
+	if dec.recordSpans {
+		g.Offset = dec.gobOffset
+		g.Raw = dec.raw
+		g.Spans = dec.spans
+	}
+	g.Guesses = dec.guesses
+	if len(dec.gobTypes) > 0 {
+		// the decoder carries on renaming its types so the Gob gets copies
+		// of them that nothing else changes
+		g.Types = make(map[TypeID]*WireType, len(dec.gobTypes))
+		for id, w := range dec.gobTypes {
+			t := w.copy()
+			t.types = g.Types
+			g.Types[id] = t
 			switch {
 			case t.SliceT != nil:
 				t.SliceT.ElemTypeString = dec.getName(t.SliceT.Elem)
@@ -118,11 +192,13 @@ func (dec *Decoder) setGob(g *Gob) {
 				t.MapT.ElemTypeString = dec.getName(t.MapT.Elem)
 			case t.StructT != nil:
 				for _, f := range t.StructT.Field {
-					f.TypeString = dec.getName(typeId(f.Id))
+					f.TypeString = dec.getName(f.Id)
+					if f.hint != nil {
+						f.TypeString = f.hint.expr
+					}
 				}
 			}
 		}
-		g.Types = dec.seenTypes
 	}
 }
 
@@ -139,13 +215,15 @@ type Result struct {
 // according to gob structure once I hit a non negative type id I've left
 // my gob. The problem I have is that second star they put in that defintion
 //
-// (byteCount (-type id, encoding of a wireType)* (type id, encoding of a value))*
-//                                                                    here ~~~~~~^
+//	(byteCount (-type id, encoding of a wireType)* (type id, encoding of a value))*
+//	                                                                   here ~~~~~~^
+//
 // it would seem that that be an issue with this method of dealing with
 // finding a problematic gob. How do I know that I'm actually in the last one?
-func (dec *Decoder) streamError(c chan<- Result, stop <-chan struct{}) bool {
-	c <- Result{Err: dec.err}
-	if dec.err.Err == io.ErrUnexpectedEOF {
+func (dec *Decoder) streamError() bool {
+	// there's no finding the next message without reading one that is too
+	// big
+	if dec.err.Err == io.ErrUnexpectedEOF || errors.Is(dec.err, ErrMessageTooBig) {
 		return false
 	}
 	if dec.inValue {
@@ -154,30 +232,75 @@ func (dec *Decoder) streamError(c chan<- Result, stop <-chan struct{}) bool {
 		dec.clearGob()
 		return true
 	}
-	for {
-		// set it to nil so we can just keep eating
-		dec.err = nil
-		// we're jsut going to ignore errors until
-		// we are in a value piece and then break
+	// we lost a type definition so nothing in this session can be trusted
+	// anymore. nextGob skips messages until it is past the next value.
+	dec.resetTypes()
+	dec.skipping = true
+	dec.decodedValue = nil
+	dec.err = nil
+	dec.clearGob()
+	return true
+}
+
+// skipMessage drops the message getGobPiece just read while skipping to
+// the end of a gob whose types were lost. It returns false if the stream
+// can't go on.
+func (dec *Decoder) skipMessage() bool {
+	// we're jsut going to ignore errors until
+	// we are in a value piece and then stop
+	if dec.err == nil {
+		if id := dec.readTypeId(); dec.err == nil && id > 0 {
+			dec.skipping = false
+		}
+	}
+	if dec.err != nil && (dec.err.Err == io.ErrUnexpectedEOF || errors.Is(dec.err, ErrMessageTooBig)) {
+		return false
+	}
+	dec.err = nil
+	dec.gobBuf.Reset()
+	dec.clearGob()
+	return true
+}
+
+// nextGob decodes the next Gob in the stream. After an error it gets ready
+// to carry on after the gob that had it, or sets done if it can't. It
+// returns nil for both once there's nothing left.
+func (dec *Decoder) nextGob(stop func() bool) (*Gob, *Error) {
+	for !dec.done {
 		dec.getGobPiece()
-		id := dec.readTypeId()
-		if id > 0 {
+		if dec.err != nil && dec.err.Err == io.EOF {
+			dec.done = true
 			break
 		}
-		// if we ever hit EOF we have to leave
-		if dec.err.Err == io.EOF || dec.err.Err == io.ErrUnexpectedEOF {
-			return false
+		if dec.skipping {
+			dec.done = !dec.skipMessage() || (stop != nil && stop())
+			continue
 		}
-		select {
-		case <-stop:
-			return false
-		default:
+		dec.decodeGobPiece()
+		if dec.err != nil {
+			dec.locateErr()
+			err := dec.err
+			dec.done = !dec.streamError()
+			return nil, err
+		}
+		if dec.decodedValue != nil {
+			g := new(Gob)
+			dec.setGob(g)
+			dec.clearGob()
+			return g, nil
 		}
 	}
-	dec.decodedValue = nil
-	dec.err = nil
+	return nil, nil
+}
+
+// startStream resets the counters for DecodeStream and DecodeStreamContext
+func (dec *Decoder) startStream() {
+	dec.bytesProcessed = 0
+	dec.streamPos = 0
+	dec.messages = 0
+	dec.done = false
+	dec.skipping = false
 	dec.clearGob()
-	return true
 }
 
 // DecodeStream keeps reading from the underlying reader and returning
@@ -191,44 +314,90 @@ func (dec *Decoder) streamError(c chan<- Result, stop <-chan struct{}) bool {
 // stop the streamer and restart it.
 //
 // If you don't want any buffering just send buffer as 0.
+//
+// The goroutine doing the decoding blocks sending on the channel until
+// the result is received even when stop is closed. Use DecodeStreamContext
+// if whatever is receiving might go away.
 func (dec *Decoder) DecodeStream(stop <-chan struct{}, buffer int) <-chan Result {
-	dec.bytesProcessed = 0
-	dec.clearGob()
+	dec.startStream()
 	c := make(chan Result, buffer)
+	stopped := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
 	go func() {
 		defer close(c)
 		for {
-			dec.getGobPiece()
-			if dec.err != nil {
-				if dec.err.Err == io.EOF {
-					return
-				}
-				if !dec.streamError(c, stop) {
-					return
-				}
+			g, err := dec.nextGob(stopped)
+			if g == nil && err == nil {
+				return
 			}
-			dec.decodeGobPiece()
-			if dec.err != nil {
-				if !dec.streamError(c, stop) {
-					return
-				}
+			c <- Result{Gob: g, Err: err}
+			if stopped() {
+				return
 			}
-			if dec.decodedValue != nil {
-				g := new(Gob)
-				dec.setGob(g)
-				c <- Result{Gob: g}
-				select {
-				case <-stop:
-					return
-				default:
-					dec.clearGob()
-				}
+		}
+	}()
+	return c
+}
+
+// DecodeStreamContext is DecodeStream stopped by a context. Once ctx is done
+// the goroutine decoding stops without sending anything else and closes the
+// channel, so receiving until the channel is closed waits for it to finish.
+//
+// A Read that is blocked when ctx is done still has to return first. If the
+// reader has a SetReadDeadline method, like a net.Conn, the deadline is set
+// to now to make that happen straight away.
+func (dec *Decoder) DecodeStreamContext(ctx context.Context) <-chan Result {
+	dec.startStream()
+	c := make(chan Result)
+	stopped := func() bool {
+		return ctx.Err() != nil
+	}
+	go func() {
+		defer close(c)
+		if d, ok := dec.src.(interface{ SetReadDeadline(time.Time) error }); ok {
+			unblock := context.AfterFunc(ctx, func() {
+				d.SetReadDeadline(time.Now())
+			})
+			defer unblock()
+		}
+		for {
+			g, err := dec.nextGob(stopped)
+			// whatever was read after ctx was done, including the error
+			// from the deadline, isn't wanted
+			if (g == nil && err == nil) || stopped() {
+				return
+			}
+			select {
+			case c <- Result{Gob: g, Err: err}:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 	return c
 }
 
+// Next decodes and returns the next Gob from the reader, or io.EOF once
+// there are no more. Like DecodeStream an error doesn't stop it. The gob
+// that had it is dropped and the next call carries on after it unless
+// there's no carrying on, in which case that call returns io.EOF.
+func (dec *Decoder) Next() (*Gob, error) {
+	g, err := dec.nextGob(nil)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, io.EOF
+	}
+	return g, nil
+}
+
 func (dec *Decoder) genError(err error) *Error {
 	return &Error{
 		Processed: dec.bytesProcessed,
@@ -251,24 +420,40 @@ func (dec *Decoder) getGobPiece() {
 		dec.err = err
 		return
 	}
+	dec.messages++
+	if size > dec.opts.MaxMessageSize {
+		dec.err = dec.genError(fmt.Errorf("%w: %d > %d", ErrMessageTooBig, size, dec.opts.MaxMessageSize))
+		return
+	}
+	dec.truncated = false
 	dec.gobBuf.Reset()
-	dec.gobBuf.Grow(width + int(size))
 	_, err_ := dec.gobBuf.Write(dec.buf[:width])
-	if err != nil {
+	if err_ != nil {
 		dec.err = dec.genError(err_)
 		return
 	}
 	dec.gobBuf.Consumed(width)
 	// read the entire gob into the gob buffer
-	_, err_ = io.ReadFull(dec.r, dec.gobBuf.Bytes())
-	if err_ != nil {
-		if err_ == io.EOF {
-			dec.err = dec.genError(io.ErrUnexpectedEOF)
-			return
-		}
+	n, err_ := dec.gobBuf.ReadN(dec.r, size)
+	switch err_ {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		// decode as much of a message that was cut short as there is so
+		// the error says where it was cut
+		dec.truncated = true
+	default:
 		dec.err = dec.genError(err_)
 		return
 	}
+	if dec.recordSpans || dec.trace != nil {
+		if len(dec.raw) == 0 {
+			dec.gobOffset = dec.streamPos
+		}
+		dec.msgStart = len(dec.raw)
+		dec.raw = append(dec.raw, dec.gobBuf.Data()...)
+		dec.spanFrom(dec.msgStart, "msg len %d", size)
+	}
+	dec.streamPos += int64(width) + int64(n)
 }
 
 // main decoding entrypoint, decodes the gob in the gobBuf
@@ -281,36 +466,85 @@ func (dec *Decoder) decodeGobPiece() {
 	for dec.err == nil && dec.gobBuf.Len() > 0 {
 		id := dec.readTypeId()
 		if id >= 0 {
+			dec.label("type id %d value", id)
 			dec.inValue = true
-			dec.decodedValue = dec.valueForType(id)
+			dec.useType(id, 1)
+			w, ok := dec.seenTypes[id]
+			guess := !ok && !isBuiltin(id) && dec.guess
+			if !ok && !isBuiltin(id) && !guess && dec.err == nil {
+				dec.err = dec.genError(errUnknownType)
+			}
 			if dec.err != nil {
 				return
 			}
-			w, ok := dec.seenTypes[id]
+			dec.quiet = 0
+			dec.resolveTypes()
+			dec.h.MessageStart(id)
+			if guess {
+				dec.enter(dec.getName(id), -1)
+				dec.guessValue(id, dec.gobBuf.Len())
+				dec.leave()
+				dec.h.MessageEnd()
+				break
+			}
 			if !ok || w.StructT == nil {
-				dec.consumeNextUint(0)
+				dec.consumeNextUint(0, "singleton")
 			}
 			// each gob will have a value so after we read it
 			// let's return and add it to the returned *Gob's
-			dec.readValue(id, &dec.decodedValue)
-			return
+			dec.enter(dec.getName(id), -1)
+			dec.readValue(id)
+			dec.leave()
+			if dec.strict && dec.err == nil && dec.gobBuf.Len() > 0 {
+				dec.err = dec.genError(errExtraData)
+			}
+			dec.h.MessageEnd()
+			break
 		}
+		dec.label("type id %d def", id)
 		dec.inValue = false
 		// we have a type definition
 		dec.readType(-id)
+		if dec.strict && dec.err == nil && dec.gobBuf.Len() > 0 {
+			dec.err = dec.genError(errExtraData)
+		}
+	}
+	// everything in a message that was cut short decoded, but there was
+	// supposed to be more
+	if dec.err == nil && dec.truncated {
+		dec.err = dec.genError(io.ErrUnexpectedEOF)
 	}
 }
 
-func (dec *Decoder) readTypeId() typeId {
+// readBytes reads the next n bytes of the message
+func (dec *Decoder) readBytes(n int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+	if n < 0 || n > dec.gobBuf.Len() {
+		dec.err = dec.genError(io.ErrUnexpectedEOF)
+		return nil
+	}
+	if !dec.allocate(int64(n)) {
+		return nil
+	}
+	b := make([]byte, n)
+	dec.gobBuf.Read(b)
+	dec.bytesProcessed += uint64(n)
+	return b
+}
+
+func (dec *Decoder) readTypeId() TypeID {
 	if dec.err != nil {
 		return 0
 	}
+	dec.last = dec.pos()
 	n, _, err := readUint(&dec.gobBuf, dec.buf[:], &dec.bytesProcessed)
 	if err != nil {
 		dec.err = err
 		return 0
 	}
-	return typeId(uintToInt(n))
+	return TypeID(uintToInt(n))
 }
 
 // valueForWireType creates a new value for the wiretype set as
@@ -319,29 +553,47 @@ func (dec *Decoder) valueForWireType(w *WireType) Value {
 	switch {
 	case w.StructT != nil:
 		v := new(structValue)
+		v.id = w.StructT.Id
 		v.name = w.StructT.CommonType.Name
 		//v.fields = make(map[string]Value)
 		v.fields = make(structFields, len(w.StructT.Field))
+		zero := dec.zeroValues(v.id, len(v.fields))
+		if zero {
+			defer delete(dec.zeroing, v.id)
+		}
 		for i, f := range w.StructT.Field {
+			var fv Value = _unread_value{}
+			if zero {
+				fv = dec.valueForType(f.Id)
+			}
 			v.fields[i] = structField{
 				name:  f.Name,
-				value: dec.valueForType(typeId(f.Id)),
+				value: fv,
+			}
+			if f.hint != nil {
+				v.fields[i].typ = f.hint.expr
 			}
 		}
 		/*
 			for _, f := range w.StructT.Field {
-				v.fields[f.Name] = dec.valueForType(typeId(f.Id))
+				v.fields[f.Name] = dec.valueForType(f.Id)
 			}
 		*/
 		return v
 	case w.SliceT != nil:
 		v := new(sliceValue)
+		v.id = w.SliceT.Id
 		v.elemType = dec.getName(w.SliceT.Elem)
 		return v
 	case w.ArrayT != nil:
 		v := new(arrayValue)
+		v.id = w.ArrayT.Id
 		v.length = w.ArrayT.Len
 		v.elemType = dec.getName(w.ArrayT.Elem)
+		if !dec.zeroValues(v.id, v.length) {
+			return v
+		}
+		defer delete(dec.zeroing, v.id)
 		v.values = make([]Value, v.length)
 		for i := 0; i < v.length; i++ {
 			v.values[i] = dec.valueForType(w.ArrayT.Elem)
@@ -349,6 +601,7 @@ func (dec *Decoder) valueForWireType(w *WireType) Value {
 		return v
 	case w.MapT != nil:
 		v := new(mapValue)
+		v.id = w.MapT.Id
 		v.keyType = dec.getName(w.MapT.Key)
 		v.elemType = dec.getName(w.MapT.Elem)
 		//v.values = make(map[Value]Value)
@@ -357,290 +610,453 @@ func (dec *Decoder) valueForWireType(w *WireType) Value {
 	// gets to encode the value however they want.
 	case w.BinaryMarshalerT != nil:
 		v := new(opaqueEncodedValue)
+		v.id = w.BinaryMarshalerT.Id
 		v.name = w.BinaryMarshalerT.CommonType.Name
 		return v
 	case w.TextMarshalerT != nil:
 		v := new(opaqueEncodedValue)
+		v.id = w.TextMarshalerT.Id
 		v.name = w.TextMarshalerT.CommonType.Name
 		return v
 	case w.GobEncoderT != nil:
 		v := new(opaqueEncodedValue)
+		v.id = w.GobEncoderT.Id
 		v.name = w.GobEncoderT.CommonType.Name
 		return v
 	default:
-		panic("all nil in wiretype")
+		dec.err = dec.genError(errors.New("empty wireType"))
+		return _unread_value{}
+	}
+}
+
+// zeroValues reports whether n more zero values can be made for the struct
+// or array type id and marks it as being filled in if so. Everything inside
+// a struct or array is filled in with zero values before the fields that were
+// sent are read, so a small type definition can ask for a huge value.
+func (dec *Decoder) zeroValues(id TypeID, n int) bool {
+	if !dec.checkDepth(len(dec.zeroing)+1) || !dec.allocate(int64(n)*valueCost) {
+		return false
 	}
+	if dec.zeroing == nil {
+		dec.zeroing = make(map[TypeID]bool)
+	}
+	dec.zeroing[id] = true
+	return true
 }
 
-func (dec *Decoder) valueForType(id typeId) Value {
+func (dec *Decoder) valueForType(id TypeID) Value {
 	if isBuiltin(id) {
 		return valueFor(id)
 	}
 	if w, ok := dec.seenTypes[id]; ok {
+		if dec.zeroing[id] {
+			// a type can only contain itself through a pointer so
+			// its zero value in itself is nil
+			return _nil_value{}
+		}
 		return dec.valueForWireType(w)
 	}
-	dec.err = dec.genError(errors.New("gob had value for unknown type"))
-	return nil
+	if dec.err == nil {
+		dec.err = dec.genError(errUnknownType)
+	}
+	return _unread_value{}
 }
 
-func (dec *Decoder) readValue(id typeId, v *Value) {
+func (dec *Decoder) readValue(id TypeID) {
 	if dec.err != nil {
 		return
 	}
+	prev := dec.typeID
+	dec.typeID = id
+	defer func() {
+		// leave it for the error otherwise
+		if dec.err == nil {
+			dec.typeID = prev
+		}
+	}()
+	if !dec.allocate(valueCost) {
+		return
+	}
 	wire, ok := dec.seenTypes[id]
 	if !ok {
 		if !isBuiltin(id) {
-			dec.err = dec.genError(errors.New("unexpected type"))
+			dec.err = dec.genError(errUnexpectedType)
 			return
 		}
-		dec.readBuiltinValue(id, v)
+		dec.readBuiltinValue(id)
 	} else {
 		switch {
 		case wire.StructT != nil:
-			dec.readStructValue(wire, v)
+			dec.readStructValue(wire)
 		case wire.MapT != nil:
-			dec.readMapValue(wire, v)
+			dec.readMapValue(wire)
 		case wire.SliceT != nil:
-			dec.readSliceValue(wire, v)
+			dec.readSliceValue(wire)
 		case wire.ArrayT != nil:
-			dec.readArrayValue(wire, v)
+			dec.readArrayValue(wire)
 		case wire.GobEncoderT != nil:
-			dec.readGobEncoderValue(wire, v)
+			dec.readGobEncoderValue(wire)
 		case wire.BinaryMarshalerT != nil:
-			dec.readBinaryMarshalerValue(wire, v)
+			dec.readBinaryMarshalerValue(wire)
 		case wire.TextMarshalerT != nil:
-			dec.readTextMarshalerValue(wire, v)
+			dec.readTextMarshalerValue(wire)
 		}
 	}
 }
 
-func (dec *Decoder) readBuiltinValue(id typeId, val *Value) {
+func (dec *Decoder) readBuiltinValue(id TypeID) {
 	if dec.err != nil {
 		return
 	}
+	var val Value
 	switch id {
-	case _bool_id:
+	case BoolID:
 		b := dec.nextUint()
 		// should I check that it is 0 or 1?
 		if b == 0 {
-			*val = _bool_type(false)
+			val = _bool_type(false)
 		} else {
-			*val = _bool_type(true)
+			val = _bool_type(true)
 		}
-	case _int_id:
+		dec.label("bool %t", b != 0)
+	case IntID:
 		v := dec.nextUint()
 		if v&1 != 0 {
-			*val = _int_type(^int64(v >> 1))
+			val = _int_type(^int64(v >> 1))
 		} else {
-			*val = _int_type(int64(v >> 1))
+			val = _int_type(int64(v >> 1))
 		}
-	case _uint_id:
+		dec.label("int %d", val)
+	case UintID:
 		v := dec.nextUint()
-		*val = _uint_type(v)
-	case _float_id:
+		val = _uint_type(v)
+		dec.label("uint %d", v)
+	case FloatID:
 		v := dec.nextUint()
-		*val = _float_type(uintToFloat(v))
-	case _complex_id:
+		val = _float_type(uintToFloat(v))
+		dec.label("float %v", uintToFloat(v))
+	case ComplexID:
+		start := dec.pos()
 		r := dec.nextUint()
 		i := dec.nextUint()
-		*val = _complex_type(uintToComplex(r, i))
-	case _bytes_id:
+		val = _complex_type(uintToComplex(r, i))
+		dec.spanFrom(start, "complex %v", uintToComplex(r, i))
+	case BytesID:
 		l := int(dec.nextUint())
-		b := make([]byte, l)
-		dec.gobBuf.Read(b)
-		*val = _bytes_type(b)
-	case _string_id:
+		dec.label("len %d", l)
+		start := dec.pos()
+		b := dec.readBytes(l)
+		val = _bytes_type(b)
+		dec.spanFrom(start, "bytes")
+	case StringID:
 		l := int(dec.nextUint())
-		b := make([]byte, l)
-		dec.gobBuf.Read(b)
-		*val = _string_type(b)
-	case _interface_id:
+		dec.label("len %d", l)
+		start := dec.pos()
+		b := dec.readBytes(l)
+		val = _string_type(b)
+		dec.spanFrom(start, "string %s", quoteShort(string(b)))
+	case InterfaceID:
 		nameLen := int(dec.nextUint())
-		if nameLen == 0 {
-			dec.readNilInterface(val)
-		} else {
-			dec.readNonNilInterface(val, nameLen)
+		switch {
+		case dec.err != nil:
+		case nameLen == 0:
+			dec.label("nil interface")
+			val = interfaceValue{value: _nil_value{}}
+		default:
+			dec.readNonNilInterface(nameLen)
+			return
 		}
 	default:
-		panic("id was not a builtin id")
+		dec.err = dec.genError(fmt.Errorf("type %d isn't a builtin type", id))
 	}
+	dec.scalar(val)
 }
 
-func (dec *Decoder) readNilInterface(val *Value) {
-	var into interfaceValue
-	into.value = _nil_value{}
-	*val = into
-}
-
-func (dec *Decoder) readNonNilInterface(v *Value, nl int) {
+func (dec *Decoder) readNonNilInterface(nl int) {
 	if dec.err != nil {
 		return
 	}
-	var into interfaceValue
-	nameB := make([]byte, nl)
-	dec.gobBuf.Read(nameB)
-	// interface names are kinda weird in that they will include
-	// the entire path to the interface type including package.
-	// We don't actually want that
-	into.name = string(nameB)
-	if strings.Contains(into.name, ".") {
-		tmp := strings.Split(into.name, ".")
-		into.name = tmp[len(tmp)-1]
+	dec.label("name len %d", nl)
+	start := dec.pos()
+	nameB := dec.readBytes(nl)
+	dec.spanFrom(start, "interface name %q", nameB)
+	if dec.err != nil {
+		return
 	}
-	for {
+	name := string(nameB)
+	dec.enter("("+interfaceName(name)+")", -1)
+	defer dec.leave()
+	dec.begin(func(h Handler) bool { return h.InterfaceStart(name) })
+	for dec.err == nil {
 		id := dec.readTypeId()
 		if id < 0 {
+			dec.label("type id %d def", id)
+			// The concrete type wasn't sent yet so its definition is
+			// here. It is followed by a uint that is either the length
+			// of the next message or, when the definition was nested
+			// in a value, a byte count we don't need.
 			dec.readType(-id)
-			dec.getGobPiece()
+			if dec.gobBuf.Len() > 0 {
+				dec.label("byte count %d", dec.nextUint())
+			} else {
+				dec.getGobPiece()
+			}
 		} else {
-			// hmm
-			// TODO: What is this next uint telling me?
-			// I think it is a length of the next block to read
-			_ = dec.nextUint()
+			dec.label("type id %d value", id)
+			dec.useType(id, 1)
+			// the byte count of the value which is there so it can be
+			// skipped, but we want to read it
+			n := dec.nextUint()
+			dec.label("byte count %d", n)
+			dec.resolveTypes()
 			w, ok := dec.seenTypes[id]
+			if !ok && !isBuiltin(id) && dec.guess {
+				dec.guessValue(id, int(n))
+				break
+			}
+			if !ok && !isBuiltin(id) && dec.err == nil {
+				dec.err = dec.genError(errUnknownType)
+			}
 			if !ok || w.StructT == nil {
-				dec.consumeNextUint(0)
+				dec.consumeNextUint(0, "singleton")
 			}
-			dec.readValue(id, &into.value)
+			dec.readValue(id)
 			break
 		}
 	}
-	*v = into
+	dec.end()
 }
 
-func (dec *Decoder) readGobEncoderValue(wire *WireType, val *Value) {
+// interfaceName is the name of the concrete type in an interface without
+// the package. Interface names are kinda weird in that they will include
+// the entire path to the interface type including package. We don't
+// actually want that, but we keep it around for encoding.
+func interfaceName(registered string) string {
+	if strings.Contains(registered, ".") {
+		tmp := strings.Split(registered, ".")
+		return tmp[len(tmp)-1]
+	}
+	return registered
+}
+
+func (dec *Decoder) readGobEncoderValue(wire *WireType) {
 	if dec.err != nil {
 		return
 	}
 	into := dec.valueForWireType(wire).(*opaqueEncodedValue)
-	dec.readOpaqueEncodedValue(into, val)
+	dec.readOpaqueEncodedValue(into)
 }
 
-func (dec *Decoder) readBinaryMarshalerValue(wire *WireType, val *Value) {
+func (dec *Decoder) readBinaryMarshalerValue(wire *WireType) {
 	if dec.err != nil {
 		return
 	}
 	into := dec.valueForWireType(wire).(*opaqueEncodedValue)
-	dec.readOpaqueEncodedValue(into, val)
+	dec.readOpaqueEncodedValue(into)
 }
 
-func (dec *Decoder) readTextMarshalerValue(wire *WireType, val *Value) {
+func (dec *Decoder) readTextMarshalerValue(wire *WireType) {
 	if dec.err != nil {
 		return
 	}
 	into := dec.valueForWireType(wire).(*opaqueEncodedValue)
-	dec.readOpaqueEncodedValue(into, val)
+	dec.readOpaqueEncodedValue(into)
 }
 
-func (dec *Decoder) readOpaqueEncodedValue(val *opaqueEncodedValue, into *Value) {
+func (dec *Decoder) readOpaqueEncodedValue(val *opaqueEncodedValue) {
 	if dec.err != nil {
 		return
 	}
 	l := dec.nextUint()
-	b := make([]byte, l)
-	dec.gobBuf.Read(b)
+	dec.label("len %d", l)
+	start := dec.pos()
+	b := dec.readBytes(int(l))
+	if dec.err != nil {
+		return
+	}
 	val.value = _bytes_type(b)
-	*into = val
+	val.decoded = decodeOpaque(val.name, b)
+	if val.decoded != nil {
+		dec.spanFrom(start, "%s %s", val.name, val.decoded.GoString())
+	} else {
+		dec.spanFrom(start, "%s bytes", val.name)
+	}
+	dec.scalar(val)
 }
 
-func (dec *Decoder) readMapValue(wire *WireType, val *Value) {
+func (dec *Decoder) readMapValue(wire *WireType) {
 	if dec.err != nil {
 		return
 	}
-	into := dec.valueForWireType(wire).(*mapValue)
-	length := int(dec.nextUint())
-	into.values = make([]mapEntry, length)
-	for i := 0; i < length; i++ {
-		kVal := new(Value)
-		eVal := new(Value)
-		dec.readValue(wire.MapT.Key, kVal)
-		dec.readValue(wire.MapT.Elem, eVal)
-		into.values[i] = mapEntry{key: *kVal, elem: *eVal}
-		//into.values[*kVal] = *eVal
+	length := dec.readLength()
+	if dec.err != nil {
+		return
 	}
-	*val = into
+	dec.label("map len %d", length)
+	dec.begin(func(h Handler) bool { return h.MapStart(wire, length) })
+	for i := 0; i < length && dec.err == nil; i++ {
+		dec.enter("", i)
+		skip := dec.mapEntry(i)
+		dec.readValue(wire.MapT.Key)
+		dec.readValue(wire.MapT.Elem)
+		dec.unquiet(skip)
+		dec.leave()
+	}
+	dec.end()
 }
 
-func (dec *Decoder) readSliceValue(wire *WireType, val *Value) {
+// readLength reads the number of elements in a slice, array or map
+func (dec *Decoder) readLength() int {
+	n := dec.nextUint()
+	if !dec.checkElements(n) {
+		return 0
+	}
+	return int(n)
+}
+
+// elemCap is how much room to make for length elements. Every element takes
+// at least a byte so there can't be more than are left in the message.
+func (dec *Decoder) elemCap(length int) int {
+	if length < 0 {
+		return 0
+	}
+	if left := dec.gobBuf.Len(); length > left {
+		return left
+	}
+	return length
+}
+
+func (dec *Decoder) readSliceValue(wire *WireType) {
+	if dec.err != nil {
+		return
+	}
+	length := dec.readLength()
 	if dec.err != nil {
 		return
 	}
-	length := int(dec.nextUint())
-	into := dec.valueForWireType(wire).(*sliceValue)
-	into.values = make([]Value, length)
-	for i := 0; i < length; i++ {
-		dec.readValue(wire.SliceT.Elem, &into.values[i])
+	dec.label("slice len %d", length)
+	dec.begin(func(h Handler) bool { return h.SliceStart(wire, length) })
+	for i := 0; i < length && dec.err == nil; i++ {
+		dec.enter("", i)
+		dec.readValue(wire.SliceT.Elem)
+		dec.leave()
 	}
-	*val = into
+	dec.end()
 }
 
-func (dec *Decoder) readArrayValue(wire *WireType, val *Value) {
+func (dec *Decoder) readArrayValue(wire *WireType) {
+	if dec.err != nil {
+		return
+	}
+	length := dec.readLength()
 	if dec.err != nil {
 		return
 	}
-	into := dec.valueForWireType(wire).(*arrayValue)
-	length := int(dec.nextUint())
-	for i := 0; i < length; i++ {
-		dec.readValue(wire.ArrayT.Elem, &into.values[i])
+	dec.label("array len %d", length)
+	if length != wire.ArrayT.Len {
+		dec.err = dec.genError(fmt.Errorf("array length %d doesn't match type length %d", length, wire.ArrayT.Len))
+		return
+	}
+	dec.begin(func(h Handler) bool { return h.ArrayStart(wire, length) })
+	for i := 0; i < length && dec.err == nil; i++ {
+		dec.enter("", i)
+		dec.readValue(wire.ArrayT.Elem)
+		dec.leave()
 	}
-	*val = into
+	dec.end()
 }
 
-func (dec *Decoder) readStructValue(wire *WireType, val *Value) {
+func (dec *Decoder) readStructValue(wire *WireType) {
 	if dec.err != nil {
 		return
 	}
-	into := dec.valueForWireType(wire).(*structValue)
+	name := wire.StructT.CommonType.Name
 	fields := wire.StructT.Field
+	dec.begin(func(h Handler) bool { return h.StructStart(wire) })
 	fieldNum := -1
 	for {
 		delta := int(dec.nextUint())
 		if delta == 0 || dec.err != nil {
+			dec.label("end of %s", name)
 			break
 		}
-		fieldNum += delta
-		if fieldNum < 0 || fieldNum >= len(fields) {
+		if next := fieldNum + delta; next < 0 || next >= len(fields) {
 			dec.err = dec.genError(errors.New("bad fieldnum"))
-			return
-		}
-		id := typeId(fields[fieldNum].Id)
-		var v Value
-		if isBuiltin(id) {
-			v = valueFor(id)
+			break
 		}
-		dec.readValue(id, &v)
-		into.fields[fieldNum].value = v
-		//into.fields[fields[fieldNum].Name] = v
+		fieldNum += delta
+		f := fields[fieldNum]
+		dec.label("field delta +%d → %s.%s", delta, name, f.Name)
+		skip := dec.structField(f.Name, f.Id)
+		dec.enter(f.Name, -1)
+		dec.readValue(f.Id)
+		dec.leave()
+		dec.unquiet(skip)
+	}
+	dec.end()
+}
+
+// orUnread marks a value that was never set because of an error
+func orUnread(v Value) Value {
+	if v == nil {
+		return _unread_value{}
 	}
-	*val = into
+	return v
 }
 
 // reads newly defined types. These will always come as WireType structs
-func (dec *Decoder) readType(id typeId) {
+func (dec *Decoder) readType(id TypeID) {
 	if dec.err != nil {
 		return
 	}
-	if id < smallestUserTypeId || dec.seenTypes[id] != nil {
+	if id < smallestUserTypeId {
 		dec.err = errDuplicateType(dec.bytesProcessed, nil)
 		return
 	}
+	if dec.seenTypes[id] != nil {
+		// A gob.Encoder only ever sends a type once, so a redefinition
+		// means a different encoder started writing to the stream.
+		if dec.definedInGob(id) || (dec.strict && !dec.tableTypes) {
+			dec.err = errDuplicateType(dec.bytesProcessed, nil)
+			return
+		}
+		dec.newSession()
+	}
+	dec.gobDefs = append(dec.gobDefs, id)
 	wire := new(WireType)
-	dec.decodeType(id, wire)
-	// Every type definition will be followed by two null bytes
-	dec.consumeNextUint(0)
-	dec.consumeNextUint(0)
+	prev := dec.typeID
+	dec.typeID = id
+	dec.enter(fmt.Sprintf("def %d", id), -1)
+	defer dec.leave()
+	typ := dec.decodeType(id, wire)
+	// Every type definition will be followed by two null bytes, the end of
+	// the type and the end of the wireType
+	dec.consumeNextUint(0, typ)
+	dec.consumeNextUint(0, "wireType")
+	wire.types = dec.seenTypes
 	dec.seenTypes[id] = wire
+	if dec.err == nil {
+		dec.defined(id, wire)
+		dec.typeID = prev
+		dec.h.TypeDefined(wire)
+	}
 }
 
 // reads the gobBuf and stores the read WireType only operates one
-// WireType at a time
-func (dec *Decoder) decodeType(id typeId, w *WireType) {
+// WireType at a time. It returns encoding/gob's name for the kind of type
+// that was read.
+func (dec *Decoder) decodeType(id TypeID, w *WireType) string {
 	if dec.err != nil {
-		return
+		return ""
 	}
 	delta := int(dec.nextUint())
 	fieldNum := delta - 1
-	dec.consumeNextUint(1)
+	if fieldNum < 0 || fieldNum >= len(wireTypeFields) {
+		dec.err = errUnknownDelta(dec.bytesProcessed, dec.gobBuf.Bytes())
+		return ""
+	}
+	dec.label("field delta +%d → wireType.%s", delta, wireTypeFields[fieldNum])
+	dec.consumeNextUint(1, wireTypeTypes[fieldNum]+".CommonType")
 	switch fieldNum {
 	case 0:
 		dec.decodeArray(id, w)
@@ -656,27 +1072,39 @@ func (dec *Decoder) decodeType(id typeId, w *WireType) {
 		dec.decodeBinaryMarshaler(id, w)
 	case 6:
 		dec.decodeTextMarshaler(id, w)
-	default:
-		dec.err = errUnknownDelta(dec.bytesProcessed, dec.gobBuf.Bytes())
-		return
 	}
+	return wireTypeTypes[fieldNum]
 }
 
-func (dec *Decoder) consumeNextUint(expected int) {
+// consumeNextUint reads a delta that can only be expected. field is what
+// the delta leads to, or what it is the end of when expected is 0.
+func (dec *Decoder) consumeNextUint(expected int, field string) {
 	if dec.err != nil {
 		return
 	}
 	delta := int(dec.nextUint())
+	if dec.err != nil {
+		return
+	}
 	if delta != expected {
 		dec.err = dec.genError(fmt.Errorf("expected delta %d but got %d", expected, delta))
 		return
 	}
+	switch {
+	case field == "singleton":
+		dec.label("singleton")
+	case expected == 0:
+		dec.label("end of %s", field)
+	default:
+		dec.label("field delta +%d → %s", expected, field)
+	}
 }
 
 func (dec *Decoder) nextUint() uint64 {
 	if dec.err != nil {
 		return 0
 	}
+	dec.last = dec.pos()
 	delta, _, err := readUint(&dec.gobBuf, dec.buf[:], &dec.bytesProcessed)
 	if err != nil {
 		dec.err = err
@@ -685,15 +1113,34 @@ func (dec *Decoder) nextUint() uint64 {
 	return delta
 }
 
-func (dec *Decoder) decodeArray(id typeId, w *WireType) {
+// peekUint returns the next uint without consuming it
+func (dec *Decoder) peekUint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	pos := dec.gobBuf.pos
+	processed := dec.bytesProcessed
+	v := dec.nextUint()
+	dec.gobBuf.pos = pos
+	dec.bytesProcessed = processed
+	return v
+}
+
+func (dec *Decoder) decodeArray(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
 	common := dec.decodeCommon()
-	dec.consumeNextUint(1)
+	dec.consumeNextUint(1, "arrayType.Elem")
 	elemId := dec.readTypeId()
-	dec.consumeNextUint(1)
+	dec.label("elem type %s", elemId)
+	dec.consumeNextUint(1, "arrayType.Len")
 	l := int(uintToInt(dec.nextUint()))
+	dec.label("len %d", l)
+	if l < 0 && dec.err == nil {
+		dec.err = dec.genError(fmt.Errorf("negative array length %d", l))
+	}
+	dec.checkElements(uint64(l))
 	w.ArrayT = &ArrayType{
 		CommonType: common,
 		Elem:       elemId,
@@ -701,44 +1148,52 @@ func (dec *Decoder) decodeArray(id typeId, w *WireType) {
 	}
 }
 
-func (dec *Decoder) decodeSlice(id typeId, w *WireType) {
+func (dec *Decoder) decodeSlice(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
 	common := dec.decodeCommon()
-	dec.consumeNextUint(1)
+	dec.consumeNextUint(1, "sliceType.Elem")
 	elemId := dec.readTypeId()
+	dec.label("elem type %s", elemId)
 	w.SliceT = &SliceType{
 		CommonType: common,
 		Elem:       elemId,
 	}
 }
 
-func (dec *Decoder) decodeStruct(id typeId, w *WireType) {
+func (dec *Decoder) decodeStruct(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
 	common := dec.decodeCommon()
-	fields := dec.decodeFields()
+	var fields []*FieldType
+	// a struct without fields doesn't send the Field slice at all
+	if dec.peekUint() != 0 {
+		fields = dec.decodeFields()
+	}
 	w.StructT = &StructType{
 		CommonType: common,
 		Field:      fields,
 	}
 	// set the name if it is anonymous
 	if common.Name == "" {
+		w.StructT.anonymous = true
 		dec.anonymousStructTypeName(w)
 	}
 }
 
-func (dec *Decoder) decodeMap(id typeId, w *WireType) {
+func (dec *Decoder) decodeMap(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
 	common := dec.decodeCommon()
-	dec.consumeNextUint(1)
+	dec.consumeNextUint(1, "mapType.Key")
 	keyId := dec.readTypeId()
-	dec.consumeNextUint(1)
+	dec.label("key type %s", keyId)
+	dec.consumeNextUint(1, "mapType.Elem")
 	elemId := dec.readTypeId()
+	dec.label("elem type %s", elemId)
 	w.MapT = &MapType{
 		CommonType: common,
 		Key:        keyId,
@@ -746,7 +1201,7 @@ func (dec *Decoder) decodeMap(id typeId, w *WireType) {
 	}
 }
 
-func (dec *Decoder) decodeBinaryMarshaler(id typeId, w *WireType) {
+func (dec *Decoder) decodeBinaryMarshaler(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
@@ -756,7 +1211,7 @@ func (dec *Decoder) decodeBinaryMarshaler(id typeId, w *WireType) {
 	}
 }
 
-func (dec *Decoder) decodeTextMarshaler(id typeId, w *WireType) {
+func (dec *Decoder) decodeTextMarshaler(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
@@ -766,7 +1221,7 @@ func (dec *Decoder) decodeTextMarshaler(id typeId, w *WireType) {
 	}
 }
 
-func (dec *Decoder) decodeGobEncoder(id typeId, w *WireType) {
+func (dec *Decoder) decodeGobEncoder(id TypeID, w *WireType) {
 	if dec.err != nil {
 		return
 	}
@@ -780,17 +1235,25 @@ func (dec *Decoder) decodeFields() []*FieldType {
 	if dec.err != nil {
 		return nil
 	}
-	// TODO: potential bug here for empty structs?
-	dec.consumeNextUint(1)
-	nfields := int(dec.nextUint())
-	fields := make([]*FieldType, nfields)
-	for i := 0; i < nfields; i++ {
-		fields[i] = new(FieldType)
-		dec.consumeNextUint(1)
-		dec.decodeString(&fields[i].Name)
-		dec.consumeNextUint(1)
-		fields[i].Id = int(dec.readTypeId())
-		dec.consumeNextUint(0)
+	dec.consumeNextUint(1, "structType.Field")
+	n := dec.nextUint()
+	if !dec.checkElements(n) {
+		return nil
+	}
+	nfields := int(n)
+	dec.label("%d fields", nfields)
+	fields := make([]*FieldType, 0, dec.elemCap(nfields))
+	for i := 0; i < nfields && dec.err == nil; i++ {
+		dec.enter("Field", i)
+		f := new(FieldType)
+		dec.consumeNextUint(1, "fieldType.Name")
+		dec.decodeString(&f.Name)
+		dec.consumeNextUint(1, "fieldType.Id")
+		f.Id = dec.readTypeId()
+		dec.label("field type %s", f.Id)
+		dec.consumeNextUint(0, "fieldType")
+		dec.leave()
+		fields = append(fields, f)
 	}
 	return fields
 }
@@ -801,18 +1264,24 @@ func (dec *Decoder) decodeCommon() CommonType {
 		return c
 	}
 	fieldNum := -1
+	dec.enter("CommonType", -1)
+	defer dec.leave()
 	for {
 		delta := int(dec.nextUint())
 		// the end is noted with delta 0
 		if delta == 0 {
+			dec.label("end of CommonType")
 			break
 		}
 		fieldNum += delta
 		switch fieldNum {
 		case 0:
+			dec.label("field delta +%d → CommonType.Name", delta)
 			dec.decodeString(&c.Name)
 		case 1:
-			c.Id = int(dec.readTypeId())
+			dec.label("field delta +%d → CommonType.Id", delta)
+			c.Id = dec.readTypeId()
+			dec.label("type id %d", c.Id)
 		default:
 			dec.err = errCorruptCommonType(dec.bytesProcessed, dec.gobBuf.Bytes())
 			return c
@@ -826,6 +1295,22 @@ func (dec *Decoder) decodeString(into *string) {
 		return
 	}
 	l := dec.nextUint()
+	if dec.err != nil {
+		return
+	}
+	dec.label("len %d", l)
+	if l > uint64(dec.gobBuf.Len()) {
+		if dec.truncated {
+			dec.err = dec.genError(io.ErrUnexpectedEOF)
+			return
+		}
+		dec.err = errBadString(dec.bytesProcessed, dec.gobBuf.Bytes())
+		return
+	}
+	if !dec.allocate(int64(l)) {
+		return
+	}
+	start := dec.pos()
 	b := make([]byte, l)
 	r, err_ := dec.gobBuf.Read(b)
 	if err_ != nil {
@@ -838,19 +1323,100 @@ func (dec *Decoder) decodeString(into *string) {
 	}
 	dec.bytesProcessed += uint64(r)
 	if uint64(r) != l {
+		if dec.truncated {
+			dec.err = dec.genError(io.ErrUnexpectedEOF)
+			return
+		}
 		dec.err = errBadString(dec.bytesProcessed, dec.gobBuf.Bytes())
 		return
 	}
 	*into = string(b)
+	dec.spanFrom(start, "%q", *into)
 }
 
-// clears any gob that is already seenTypes
+// clears the state for the current gob. The types defined so far stay
+// around because the encoder won't send them again.
 func (dec *Decoder) clearGob() {
-	dec.seenTypes = make(map[typeId]*WireType)
+	dec.gobTypes = make(map[TypeID]*WireType)
+	dec.gobDefs = dec.gobDefs[:0]
 	dec.decodedValue = nil
+	dec.spans = nil
+	dec.raw = nil
+	dec.msgStart = 0
+	dec.frames = dec.frames[:0]
+	dec.typeID = 0
+	dec.alloc = 0
+	dec.guesses = nil
+}
+
+// starts a new encoder session, forgetting every type seen so far
+func (dec *Decoder) resetTypes() {
+	dec.seenTypes = make(map[TypeID]*WireType)
+	dec.tableTypes = false
+	dec.fixedNames = nil
+	dec.hintedNames = nil
+	dec.schemaTypes = nil
+	dec.uses = nil
+	dec.takenNames = nil
+	dec.numbered = nil
+	dec.pending = dec.pending[:0]
+}
+
+// newSession starts a new encoder session at a type that was already
+// defined. Type IDs are the same in every encoder in a process so the new
+// encoder can have sent types the old one didn't have before the ones it
+// did, and the types defined since the last value are kept.
+func (dec *Decoder) newSession() {
+	old := dec.seenTypes
+	dec.resetTypes()
+	for _, id := range dec.gobDefs {
+		w := old[id]
+		w.types = dec.seenTypes
+		dec.seenTypes[id] = w
+		dec.defined(id, w)
+	}
+}
+
+func (dec *Decoder) definedInGob(id TypeID) bool {
+	for _, d := range dec.gobDefs {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
+
+// useType marks the type and everything it refers to as used by the
+// current gob. It is also where types nested more than MaxDepth deep are
+// caught, before anything else recurses through them.
+func (dec *Decoder) useType(id TypeID, depth int) {
+	if isBuiltin(id) || !dec.checkDepth(depth) {
+		return
+	}
+	if _, ok := dec.gobTypes[id]; ok {
+		return
+	}
+	w, ok := dec.seenTypes[id]
+	if !ok {
+		return
+	}
+	dec.gobTypes[id] = w
+	switch {
+	case w.SliceT != nil:
+		dec.useType(w.SliceT.Elem, depth+1)
+	case w.ArrayT != nil:
+		dec.useType(w.ArrayT.Elem, depth+1)
+	case w.MapT != nil:
+		dec.useType(w.MapT.Key, depth+1)
+		dec.useType(w.MapT.Elem, depth+1)
+	case w.StructT != nil:
+		for _, f := range w.StructT.Field {
+			dec.useType(f.Id, depth+1)
+		}
+	}
 }
 
-func (dec *Decoder) getName(id typeId) string {
+func (dec *Decoder) getName(id TypeID) string {
 	if isBuiltin(id) {
 		return strings.TrimSpace(id.name())
 	}
@@ -861,45 +1427,50 @@ func (dec *Decoder) getName(id typeId) string {
 				return strings.TrimSpace(dec.anonymousStructTypeName(v))
 			}
 			return strings.TrimSpace(v.StructT.CommonType.Name)
+		// unnamed slices, maps and arrays are written out in full
 		case v.SliceT != nil:
+			if v.SliceT.CommonType.Name == "" {
+				return dec.unnamedTypeName(id, func() string {
+					return "[]" + dec.getName(v.SliceT.Elem)
+				})
+			}
 			return strings.TrimSpace(v.SliceT.CommonType.Name)
 		case v.MapT != nil:
+			if v.MapT.CommonType.Name == "" {
+				return dec.unnamedTypeName(id, func() string {
+					return fmt.Sprintf("map[%s]%s", dec.getName(v.MapT.Key), dec.getName(v.MapT.Elem))
+				})
+			}
 			return strings.TrimSpace(v.MapT.CommonType.Name)
 		case v.ArrayT != nil:
+			if v.ArrayT.CommonType.Name == "" {
+				return dec.unnamedTypeName(id, func() string {
+					return fmt.Sprintf("[%d]%s", v.ArrayT.Len, dec.getName(v.ArrayT.Elem))
+				})
+			}
 			return strings.TrimSpace(v.ArrayT.CommonType.Name)
 		case v.BinaryMarshalerT != nil:
-			return strings.TrimSpace(v.BinaryMarshalerT.CommonType.Name)
+			return strings.TrimSpace(v.BinaryMarshalerT.CommonType.opaqueName())
 		case v.GobEncoderT != nil:
-			return strings.TrimSpace(v.GobEncoderT.CommonType.Name)
+			return strings.TrimSpace(v.GobEncoderT.CommonType.opaqueName())
 		case v.TextMarshalerT != nil:
-			return strings.TrimSpace(v.TextMarshalerT.CommonType.Name)
-
-		default:
-			panic("empty wiretype at chosen id")
+			return strings.TrimSpace(v.TextMarshalerT.CommonType.opaqueName())
 		}
-	} else {
-		panic("something has gone very wrong")
 	}
+	// decoding will already have failed on a type that doesn't exist
+	return fmt.Sprintf("Undefined%d", id)
 }
 
-func (dec *Decoder) anonymousStructTypeName(w *WireType) string {
-	s := fmt.Sprintf("Anon%d", w.StructT.Id)
-	if anonTypes != nil {
-		follow := make([]byte, 4)
-		_, _ = rand.Read(follow)
-		var followString string
-		for {
-			followString = hex.EncodeToString(follow)
-			if _, ok := anonTypes[followString]; ok {
-				// this shouldn't happen much
-				_, _ = rand.Read(follow)
-			} else {
-				anonTypes[followString] = struct{}{}
-				break
-			}
-		}
-		s += fmt.Sprintf("_%s", followString)
-	}
-	w.StructT.CommonType.Name = s
-	return s
+// unnamedTypeName returns the full name of an unnamed type unless the type
+// contains itself, in which case it is called Anon<ID> like WriteSource does
+func (dec *Decoder) unnamedTypeName(id TypeID, name func() string) string {
+	if dec.naming[id] {
+		return fmt.Sprintf("Anon%d", id)
+	}
+	if dec.naming == nil {
+		dec.naming = make(map[TypeID]bool)
+	}
+	dec.naming[id] = true
+	defer delete(dec.naming, id)
+	return name()
 }
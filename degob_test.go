@@ -2,8 +2,12 @@ package degob
 
 import (
 	"bytes"
+	"context"
+	"encoding/gob"
 	"io"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestDegob(t *testing.T) {
@@ -68,6 +72,70 @@ func TestKillGobStream(t *testing.T) {
 	}
 }
 
+func TestNext(t *testing.T) {
+	var buf bytes.Buffer
+	for _, obj := range testObjects[:3] {
+		fileToBufferTest(obj.fileName, &buf, t)
+	}
+	d := NewDecoder(&buf)
+	for _, obj := range testObjects[:3] {
+		g, err := d.Next()
+		if err != nil {
+			t.Fatalf("err: %v decoding gob in file: %s", err, obj.fileName)
+		}
+		compareGobs(obj.expected, g, obj.fileName, t)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Next(); err != io.EOF {
+			t.Fatal("expected EOF got", err)
+		}
+	}
+}
+
+func TestDecodeStreamContext(t *testing.T) {
+	obj := testObjects[0]
+	var buf bytes.Buffer
+	fileToBufferTest(obj.fileName, &buf, t)
+	r, w := net.Pipe()
+	defer w.Close()
+	go w.Write(buf.Bytes())
+	ctx, cancel := context.WithCancel(context.Background())
+	out := NewDecoder(r).DecodeStreamContext(ctx)
+	res := <-out
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	compareGobs(obj.expected, res.Gob, obj.fileName, t)
+	// the decoder is now blocked reading from the pipe which cancelling
+	// has to interrupt
+	cancel()
+	select {
+	case res, ok := <-out:
+		if ok {
+			t.Fatal("expected the stream to be closed got", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream wasn't closed after cancelling")
+	}
+
+	// nothing is receiving so the decoder is blocked sending
+	buf.Reset()
+	for _, obj := range testObjects[:3] {
+		fileToBufferTest(obj.fileName, &buf, t)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	out = NewDecoder(&buf).DecodeStreamContext(ctx)
+	<-out
+	cancel()
+	n := 0
+	for range out {
+		n++
+	}
+	if n > 1 {
+		t.Fatalf("expected at most 1 more result after cancelling got %d", n)
+	}
+}
+
 func TestDuplicateDefinition(t *testing.T) {
 	obj := testObjects[0]
 	var buf bytes.Buffer
@@ -139,11 +207,11 @@ func TestUnexpectedEOFStream(t *testing.T) {
 			b := make([]byte, 5)
 			_, err := io.ReadFull(f, b)
 			if err != nil {
-				t.Fatal("error reading to buf %v", err)
+				t.Fatalf("error reading to buf %v", err)
 			}
 			_, err = buf.Write(b)
 			if err != nil {
-				t.Fatal("error writing to buf %v", err)
+				t.Fatalf("error writing to buf %v", err)
 			}
 			break
 		}
@@ -194,6 +262,58 @@ func TestUnexpectedEOF(t *testing.T) {
 	}
 }
 
+func TestDecodeLenient(t *testing.T) {
+	var buf bytes.Buffer
+	fileToBufferTest("nestedstructfull.bin", &buf, t)
+	full := buf.Len()
+	// a whole gob from one encoder and most of one from another
+	data := append(append([]byte{}, buf.Bytes()...), buf.Bytes()[:120]...)
+
+	if gobs, err := NewDecoder(bytes.NewReader(data)).Decode(); err == nil || gobs != nil {
+		t.Fatalf("expected Decode to fail without gobs but got %v and %v", gobs, err)
+	}
+	gobs, err := NewDecoder(bytes.NewReader(data)).DecodeLenient()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	derr := err.(*Error)
+	if derr.Err != io.ErrUnexpectedEOF || derr.Message != 5 || derr.TypeID != StringID || derr.Path != "Test.Z" {
+		t.Fatalf("expected an unexpected EOF in message 5 at Test.Z reading a string but got %+v", derr)
+	}
+	if len(gobs) != 2 || gobs[0].Partial || !gobs[1].Partial {
+		t.Fatalf("expected a whole gob and a partial one but got %d", len(gobs))
+	}
+	s := gobs[1].Value.(StructValue)
+	if x, _ := s.Field("X"); x.(IntValue).Int() != -10 {
+		t.Errorf("expected X to have been read but it was %s", x.Display(SingleLine))
+	}
+	if z, _ := s.Field("Z"); z.Kind() != Unread {
+		t.Errorf("expected Z to be unread but it was %s", z.Display(SingleLine))
+	}
+
+	// cut off in a struct in the middle of a field
+	gobs, err = NewDecoder(bytes.NewReader(data[:full+100])).DecodeLenient()
+	if err == nil || err.(*Error).Path != "Test.W.B" {
+		t.Fatalf("expected an error at Test.W.B but got %v", err)
+	}
+	w, _ := gobs[1].Value.(StructValue).Field("W")
+	if got := gobs[1].Value.Display(SingleLine); got != "Test{W: Inner{A: 3.14, B: /* unread */, C: /* unread */}, X: /* unread */, Y: /* unread */, Z: /* unread */}" {
+		t.Errorf("unexpected partial value %s", got)
+	}
+	if a, _ := w.(StructValue).Field("A"); a.Kind() != Float {
+		t.Errorf("expected A to have been read but it was %s", a.Kind())
+	}
+
+	// cut off in a type definition so there is no value to return
+	gobs, err = NewDecoder(bytes.NewReader(data[:full+20])).DecodeLenient()
+	if err == nil || err.(*Error).Path != "def 65.Field[0]" || err.(*Error).TypeID != 65 {
+		t.Fatalf("expected an error in the definition of type 65 but got %v", err)
+	}
+	if len(gobs) != 1 || gobs[0].Partial {
+		t.Fatalf("expected only the whole gob but got %d", len(gobs))
+	}
+}
+
 func TestBadGobUnexpectedTypeId(t *testing.T) {
 	obj := testObjects[3]
 	var buf bytes.Buffer
@@ -215,3 +335,108 @@ func TestBadGobUnexpectedTypeId(t *testing.T) {
 		t.Fatal("expected error to be at byte 3 but was at byte", derr.Processed)
 	}
 }
+
+func TestRecursiveType(t *testing.T) {
+	type Node struct {
+		V    int
+		Next *Node
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&Node{V: 1, Next: &Node{V: 2}}); err != nil {
+		t.Fatal("encoding", err)
+	}
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Node{V: 1, Next: Node{V: 2, Next: nil}}"
+	if got := gobs[0].Value.Display(SingleLine); got != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestSessionTypes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, i := range []int{0, 1, 0, 16} {
+		if err := enc.Encode(testObjects[i].item); err != nil {
+			t.Fatal("encoding", err)
+		}
+	}
+	// a second encoder starts its own session and reuses type IDs
+	if err := gob.NewEncoder(&buf).Encode(testObjects[0].item); err != nil {
+		t.Fatal("encoding", err)
+	}
+	d := NewDecoder(&buf)
+	gobs, err := d.Decode()
+	if err != nil {
+		t.Fatal("decoding", err)
+	}
+	if len(gobs) != 5 {
+		t.Fatalf("expected 5 gobs but got %d", len(gobs))
+	}
+	for i, j := range []int{0, 1, 0, 16, 0} {
+		compareGobs(testObjects[j].expected, gobs[i], testObjects[j].fileName, t)
+	}
+	if len(gobs[3].Types) != 1 {
+		t.Fatalf("expected only the types used by the gob but got %v", gobs[3].Types)
+	}
+}
+
+type sessionInner struct{ X int }
+
+type sessionOuter struct{ Y sessionInner }
+
+func TestSessionReusedTypes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sessionInner{1}); err != nil {
+		t.Fatal("encoding", err)
+	}
+	// the second encoder defines sessionOuter, which is new, before
+	// sessionInner, which has the ID the first encoder sent it with
+	if err := gob.NewEncoder(&buf).Encode(sessionOuter{sessionInner{2}}); err != nil {
+		t.Fatal("encoding", err)
+	}
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal("decoding", err)
+	}
+	if len(gobs) != 2 {
+		t.Fatalf("expected 2 gobs but got %d", len(gobs))
+	}
+	expected := "sessionOuter{Y: sessionInner{X: 2}}"
+	if out := gobs[1].Value.Display(SingleLine); out != expected {
+		t.Fatalf("expected %s got %s", expected, out)
+	}
+}
+
+type streamTypesItem struct {
+	Tags  []string
+	Attrs map[string]int
+	Next  *streamTypesItem
+}
+
+func TestStreamTypes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for i := 0; i < 50; i++ {
+		if err := enc.Encode(streamTypesItem{Tags: []string{"a"}, Attrs: map[string]int{"b": i}}); err != nil {
+			t.Fatal("encoding", err)
+		}
+	}
+	// the types are written out while the decoder carries on, which -race
+	// checks
+	for res := range NewDecoder(&buf).DecodeStream(nil, 10) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		if err := res.Gob.WriteTypes(io.Discard); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range res.Gob.Types {
+			w.FieldType(0)
+			w.Elem()
+			w.Fingerprint()
+		}
+	}
+}
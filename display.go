@@ -4,6 +4,8 @@ package degob
 // want to spend too much time on it right now
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -37,25 +39,23 @@ func (w *WireType) String() string {
 		return w.ArrayT.String()
 	case w.MapT != nil:
 		return w.MapT.String()
+	case w.GobEncoderT != nil:
+		return w.GobEncoderT.String()
+	case w.BinaryMarshalerT != nil:
+		return w.BinaryMarshalerT.String()
+	case w.TextMarshalerT != nil:
+		return w.TextMarshalerT.String()
 	default:
 		return "Unset WireType"
 	}
 }
 
 // Id will return -1 for all nil wire types
-func (w *WireType) Id() int {
-	switch {
-	case w.StructT != nil:
-		return w.StructT.Id
-	case w.SliceT != nil:
-		return w.SliceT.Id
-	case w.ArrayT != nil:
-		return w.ArrayT.Id
-	case w.MapT != nil:
-		return w.MapT.Id
-	default:
-		return -1
+func (w *WireType) Id() TypeID {
+	if c := w.Common(); c != nil {
+		return c.Id
 	}
+	return -1
 }
 
 func (a *ArrayType) String() string {
@@ -79,20 +79,54 @@ func (m *MapType) String() string {
 	return fmt.Sprintf("// map[%s]%s", m.KeyTypeString, m.ElemTypeString)
 }
 
+// the opaque types only tell us their name so all we can show is the raw
+// bytes they encode to
+
+func (g *GobEncoderType) String() string {
+	return fmt.Sprintf("type %s []byte // GobEncoder", g.CommonType.opaqueName())
+}
+
+func (b *BinaryMarshalerType) String() string {
+	return fmt.Sprintf("type %s []byte // BinaryMarshaler", b.CommonType.opaqueName())
+}
+
+func (t *TextMarshalerType) String() string {
+	return fmt.Sprintf("type %s []byte // TextMarshaler", t.CommonType.opaqueName())
+}
+
+// types that marshal themselves with pointer receivers are sent without a
+// name when they are used through a pointer
+func (c CommonType) opaqueName() string {
+	if c.Name == "" {
+		return fmt.Sprintf("Anon%d", c.Id)
+	}
+	return c.Name
+}
+
 func (s *StructType) String() string {
 	st := fmt.Sprintf("type %s struct {\n", s.CommonType.Name)
 	nfields := len(s.Field)
 	for i, f := range s.Field {
+		st += fmt.Sprintf("\t%s %s", f.Name, f.TypeString)
+		if f.Comment != "" {
+			st += " // " + f.Comment
+		}
 		if i < nfields-1 {
-			st += fmt.Sprintf("\t%s %s\n", f.Name, f.TypeString)
+			st += "\n"
 		} else {
-			st += fmt.Sprintf("\t%s %s\n}", f.Name, f.TypeString)
+			st += "\n}"
 		}
 	}
 	return st
 }
 
 func (oev *opaqueEncodedValue) Display(sty style) string {
+	if oev.decoded != nil {
+		if sty == JSON {
+			return oev.decoded.JSON()
+		}
+		return oev.decoded.GoString()
+	}
 	return oev.value.Display(sty)
 }
 
@@ -107,13 +141,11 @@ func (v sliceValue) valuesSep(sty style, sep string) string {
 func (v sliceValue) Display(sty style) string {
 	switch sty {
 	case JSON:
-		return fmt.Sprintf("[%s]", v.valuesSep(sty, ","))
-	case SingleLine:
-		return fmt.Sprintf("[]%s{%s}", v.elemType, v.valuesSep(SingleLine, ", "))
+		return fmt.Sprintf("[%s]", v.valuesSep(sty, ", "))
 	case CommentedSingleLine:
 		return fmt.Sprintf("//[]%s{%s}", v.elemType, v.valuesSep(SingleLine, ", "))
 	default:
-		panic("unimplemented style")
+		return fmt.Sprintf("[]%s{%s}", v.elemType, v.valuesSep(SingleLine, ", "))
 	}
 }
 
@@ -128,13 +160,11 @@ func (v arrayValue) valuesSep(sty style, sep string) string {
 func (v arrayValue) Display(sty style) string {
 	switch sty {
 	case JSON:
-		return fmt.Sprintf("[%s]", v.valuesSep(sty, ","))
-	case SingleLine:
-		return fmt.Sprintf("[%d]%s{%s}", v.length, v.elemType, v.valuesSep(SingleLine, ", "))
+		return fmt.Sprintf("[%s]", v.valuesSep(sty, ", "))
 	case CommentedSingleLine:
 		return fmt.Sprintf("//[%d]%s{%s}", v.length, v.elemType, v.valuesSep(SingleLine, ", "))
 	default:
-		panic("unimplemented style")
+		return fmt.Sprintf("[%d]%s{%s}", v.length, v.elemType, v.valuesSep(SingleLine, ", "))
 	}
 }
 
@@ -154,7 +184,7 @@ func (v mapValue) getValues(sty style) string {
 	i := 0
 	for _, v := range v.values {
 		if i < nval-1 {
-			out += fmt.Sprintf("%s: %s,", v.key.Display(sty), v.elem.Display(sty))
+			out += fmt.Sprintf("%s: %s, ", v.key.Display(sty), v.elem.Display(sty))
 		} else {
 			out += fmt.Sprintf("%s: %s", v.key.Display(sty), v.elem.Display(sty))
 		}
@@ -169,10 +199,8 @@ func (v mapValue) Display(sty style) string {
 		return v.displayJSON()
 	case CommentedSingleLine:
 		return fmt.Sprintf("//map[%s]%s{%s}", v.keyType, v.elemType, v.getValues(sty))
-	case SingleLine:
-		return fmt.Sprintf("map[%s]%s{%s}", v.keyType, v.elemType, v.getValues(sty))
 	default:
-		panic("unknown style requested")
+		return fmt.Sprintf("map[%s]%s{%s}", v.keyType, v.elemType, v.getValues(SingleLine))
 	}
 }
 
@@ -186,9 +214,9 @@ func (v mapValue) displayJSON() string {
 	s := "{"
 	end := len(v.values)
 	for i, v := range v.values {
-		s += fmt.Sprintf("%s:%s", v.key.Display(JSON), v.elem.Display(JSON))
+		s += fmt.Sprintf("%s: %s", v.key.Display(JSON), v.elem.Display(JSON))
 		if i+1 < end {
-			s += ","
+			s += ", "
 		}
 	}
 	s += "}"
@@ -199,12 +227,10 @@ func (s *structValue) Display(sty style) string {
 	switch sty {
 	case CommentedSingleLine:
 		return s.commentedSingleLine()
-	case SingleLine:
-		return s.singleLine()
 	case JSON:
 		return s.json()
 	default:
-		panic("unknown style requested")
+		return s.singleLine()
 	}
 }
 
@@ -217,7 +243,7 @@ func (s *structValue) getFieldVals(newline bool, sty style) string {
 	nfields := len(s.fields)
 	i := 0
 	for _, v := range s.fields {
-		out += fmt.Sprintf("%s: %s", v.name, v.value.Display(sty))
+		out += fmt.Sprintf("%s: %s", v.name, v.display(sty))
 		if i < nfields-1 {
 			if newline {
 				out += ",\n"
@@ -234,6 +260,21 @@ func (s *structValue) getFieldVals(newline bool, sty style) string {
 	return out
 }
 
+// display shows the field's value as the type Hints gave it
+func (f structField) display(sty style) string {
+	b, ok := f.value.(_bytes_type)
+	if !ok || f.typ != "json.RawMessage" || !json.Valid(b) {
+		return f.value.Display(sty)
+	}
+	if sty != JSON {
+		return fmt.Sprintf("json.RawMessage(%#q)", string(b))
+	}
+	// it has to stay on one line
+	var buf bytes.Buffer
+	_ = json.Compact(&buf, b)
+	return buf.String()
+}
+
 func (s *structValue) singleLine() string {
 	return fmt.Sprintf("%s{%s}", s.name, s.getFieldVals(false, SingleLine))
 }
@@ -242,9 +283,9 @@ func (s *structValue) json() string {
 	str := "{"
 	end := len(s.fields)
 	for i, v := range s.fields {
-		str += fmt.Sprintf("\"%s\":%s", v.name, v.value.Display(JSON))
+		str += fmt.Sprintf("\"%s\": %s", v.name, v.display(JSON))
 		if i+1 < end {
-			str += ","
+			str += ", "
 		}
 	}
 	str += "}"
@@ -268,7 +309,7 @@ func (v _float_type) Display(sty style) string {
 func (v _bytes_type) Display(sty style) string {
 	if sty == JSON {
 		s := fmt.Sprintf("%d", v)
-		return strings.Join(strings.Split(s, " "), ",")
+		return strings.Join(strings.Split(s, " "), ", ")
 	}
 	return fmt.Sprintf("%#v", []byte(v))
 }
@@ -277,7 +318,7 @@ func (v _string_type) Display(sty style) string {
 }
 func (v _complex_type) Display(sty style) string {
 	if sty == JSON {
-		return fmt.Sprintf(`{"Re":%f,"Im":%f}`, real(v), imag(v))
+		return fmt.Sprintf(`{"Re": %f, "Im": %f}`, real(v), imag(v))
 	}
 	return fmt.Sprintf("%#v", complex128(v))
 }
@@ -290,3 +331,9 @@ func (v _nil_value) Display(sty style) string {
 	}
 	return "nil"
 }
+func (v _unread_value) Display(sty style) string {
+	if sty == JSON {
+		return "null"
+	}
+	return "/* unread */"
+}
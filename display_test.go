@@ -15,7 +15,7 @@ func TestDisplayArray(t *testing.T) {
 				Name: "",
 				Id:   12345,
 			},
-			Elem:           _string_id,
+			Elem:           StringID,
 			ElemTypeString: "string",
 			Len:            10,
 		},
@@ -35,7 +35,7 @@ func TestDisplaySlice(t *testing.T) {
 				Name: "",
 				Id:   12345,
 			},
-			Elem:           _string_id,
+			Elem:           StringID,
 			ElemTypeString: "string",
 		},
 	}
@@ -87,8 +87,7 @@ func TestDisplayStruct(t *testing.T) {
 
 func TestDisplayStructVal(t *testing.T) {
 	v := structValue{
-		name:   "Foo",
-		sorted: true,
+		name: "Foo",
 		fields: structFields{
 			structField{name: "Complex", value: _complex_type(1 + 2i)},
 			structField{name: "String", value: _string_type("1 + 2i")},
@@ -119,9 +118,9 @@ func TestDisplayMapVal(t *testing.T) {
 		},
 	}
 	out := v.Display(SingleLine)
-	cmp(out, "map[string]int64{\"foo\": 12,\"bar\": -10}", t)
+	cmp(out, "map[string]int64{\"foo\": 12, \"bar\": -10}", t)
 	out = v.Display(CommentedSingleLine)
-	cmp(out, "//map[string]int64{\"foo\": 12,\"bar\": -10}", t)
+	cmp(out, "//map[string]int64{\"foo\": 12, \"bar\": -10}", t)
 	out = v.Display(JSON)
 	cmp(out, `{"foo": 12, "bar": -10}`, t)
 }
@@ -163,14 +162,12 @@ func TestDisplaySliceValue(t *testing.T) {
 
 func TestDisplayComplexStruct(t *testing.T) {
 	v := structValue{
-		name:   "Foo",
-		sorted: true,
+		name: "Foo",
 		fields: structFields{
 			structField{
 				name: "Inner",
 				value: &structValue{
-					sorted: true,
-					name:   "Bar",
+					name: "Bar",
 					fields: structFields{
 						structField{
 							name: "Array",
@@ -179,8 +176,7 @@ func TestDisplayComplexStruct(t *testing.T) {
 								elemType: "Baz",
 								values: []Value{
 									&structValue{
-										name:   "Baz",
-										sorted: true,
+										name: "Baz",
 										fields: structFields{
 											structField{
 												name:  "BazVal",
@@ -189,8 +185,7 @@ func TestDisplayComplexStruct(t *testing.T) {
 										},
 									},
 									&structValue{
-										name:   "Baz",
-										sorted: true,
+										name: "Baz",
 										fields: structFields{
 											structField{
 												name:  "BazVal",
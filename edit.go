@@ -0,0 +1,356 @@
+package degob
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Set changes the value at path to the Go literal lit. Paths look like
+// `.Session.Items[2].Qty` or `.Lookup["key"]`, with `.` on its own being the
+// whole value. Interfaces are looked through so a path continues into their
+// concrete value.
+//
+// The assignment is checked against the type that is already there so only
+// builtin values (including those inside interfaces and opaque payloads as
+// raw bytes) can be set. `nil` empties slices, maps and interfaces. Setting a
+// map key that doesn't exist adds it if the map holds builtin values.
+func (g *Gob) Set(path string, lit string) error {
+	if g.Value == nil {
+		return errors.New("gob has no value")
+	}
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	v, err := setPath(g.Value, p, 0, lit)
+	if err != nil {
+		return err
+	}
+	g.Value = v
+	return nil
+}
+
+// SetExpr is Set for an expression of the form `path=literal`
+func (g *Gob) SetExpr(expr string) error {
+	path, lit, err := splitAssignment(expr)
+	if err != nil {
+		return err
+	}
+	return g.Set(path, lit)
+}
+
+// finds the first = that isn't inside a map key
+func splitAssignment(expr string) (string, string, error) {
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '=' && depth == 0:
+			return expr[:i], expr[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("expected path=value but got %q", expr)
+}
+
+// a single step in a path. Either a field name or whatever was between
+// brackets.
+type pathElem struct {
+	field string
+	index string
+}
+
+func (p pathElem) String() string {
+	if p.index != "" {
+		return "[" + p.index + "]"
+	}
+	return "." + p.field
+}
+
+type valuePath []pathElem
+
+func (p valuePath) String() string {
+	if len(p) == 0 {
+		return "."
+	}
+	var s string
+	for _, e := range p {
+		s += e.String()
+	}
+	return s
+}
+
+func parsePath(path string) (valuePath, error) {
+	var p valuePath
+	if path == "." {
+		return p, nil
+	}
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("empty field name in path %q", path)
+			}
+			p = append(p, pathElem{field: path[i+1 : j]})
+			i = j
+		case '[':
+			end, err := closingBracket(path, i)
+			if err != nil {
+				return nil, err
+			}
+			idx := strings.TrimSpace(path[i+1 : end])
+			if idx == "" {
+				return nil, fmt.Errorf("empty index in path %q", path)
+			}
+			p = append(p, pathElem{index: idx})
+			i = end + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d in path %q", path[i], i, path)
+		}
+	}
+	return p, nil
+}
+
+func closingBracket(path string, open int) (int, error) {
+	quote := byte(0)
+	for i := open + 1; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`' || c == '\'':
+			quote = c
+		case c == ']':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated [ in path %q", path)
+}
+
+// setPath replaces the value at p[at:] under v and returns the new v
+func setPath(v Value, p valuePath, at int, lit string) (Value, error) {
+	if iv, ok := v.(interfaceValue); ok {
+		if at == len(p) && strings.TrimSpace(lit) == "nil" {
+			return interfaceValue{value: _nil_value{}}, nil
+		}
+		if iv.value == nil || iv.value.Kind() == Nil {
+			return nil, fmt.Errorf("%s: can't set through a nil interface", p[:at])
+		}
+		inner, err := setPath(iv.value, p, at, lit)
+		if err != nil {
+			return nil, err
+		}
+		iv.value = inner
+		return iv, nil
+	}
+	if at == len(p) {
+		nv, err := parseLiteral(v, lit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		return nv, nil
+	}
+	elem := p[at]
+	switch v := v.(type) {
+	case *structValue:
+		if elem.field == "" {
+			return nil, fmt.Errorf("%s: can't index a struct", p[:at+1])
+		}
+		for i, f := range v.fields {
+			if f.name == elem.field {
+				nv, err := setPath(f.value, p, at+1, lit)
+				if err != nil {
+					return nil, err
+				}
+				v.fields[i].value = nv
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %s has no field %s", p[:at+1], v.name, elem.field)
+	case *sliceValue:
+		i, err := pathIndex(p, at, len(v.values))
+		if err != nil {
+			return nil, err
+		}
+		nv, err := setPath(v.values[i], p, at+1, lit)
+		if err != nil {
+			return nil, err
+		}
+		v.values[i] = nv
+		return v, nil
+	case *arrayValue:
+		i, err := pathIndex(p, at, len(v.values))
+		if err != nil {
+			return nil, err
+		}
+		nv, err := setPath(v.values[i], p, at+1, lit)
+		if err != nil {
+			return nil, err
+		}
+		v.values[i] = nv
+		return v, nil
+	case *mapValue:
+		return setMapEntry(v, p, at, lit)
+	default:
+		return nil, fmt.Errorf("%s: can't go into a %s", p[:at+1], v.Kind())
+	}
+}
+
+func pathIndex(p valuePath, at int, length int) (int, error) {
+	if p[at].index == "" {
+		return 0, fmt.Errorf("%s: only structs have fields", p[:at+1])
+	}
+	i, err := strconv.Atoi(p[at].index)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad index: %v", p[:at+1], err)
+	}
+	if i < 0 || i >= length {
+		return 0, fmt.Errorf("%s: index out of range with length %d", p[:at+1], length)
+	}
+	return i, nil
+}
+
+func setMapEntry(m *mapValue, p valuePath, at int, lit string) (Value, error) {
+	elem := p[at]
+	if elem.index == "" {
+		return nil, fmt.Errorf("%s: only structs have fields", p[:at+1])
+	}
+	for i, e := range m.values {
+		k := e.key
+		if iv, ok := k.(interfaceValue); ok {
+			k = iv.value
+		}
+		key, err := parseLiteral(k, elem.index)
+		if err != nil || !key.Equal(k) {
+			continue
+		}
+		nv, err := setPath(e.elem, p, at+1, lit)
+		if err != nil {
+			return nil, err
+		}
+		m.values[i].elem = nv
+		return m, nil
+	}
+	// it is a new key so both types have to be ones we can make up
+	keyID, kok := builtinNamed(m.keyType)
+	elemID, eok := builtinNamed(m.elemType)
+	if !kok || keyID == InterfaceID || !eok || at+1 != len(p) {
+		return nil, fmt.Errorf("%s: no such key and can't add one to a map[%s]%s", p[:at+1], m.keyType, m.elemType)
+	}
+	key, err := parseLiteral(valueFor(keyID), elem.index)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad key: %v", p[:at+1], err)
+	}
+	nv, err := setPath(valueFor(elemID), p, at+1, lit)
+	if err != nil {
+		return nil, err
+	}
+	m.values = append(m.values, mapEntry{key: key, elem: nv})
+	m.sent = true
+	return m, nil
+}
+
+func builtinNamed(name string) (TypeID, bool) {
+	for id := BoolID; id <= InterfaceID; id++ {
+		if id.name() == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// parseLiteral parses lit as a value of the same type as v
+func parseLiteral(v Value, lit string) (Value, error) {
+	lit = strings.TrimSpace(lit)
+	switch v.Kind() {
+	case Bool:
+		b, err := strconv.ParseBool(lit)
+		return _bool_type(b), err
+	case Int:
+		i, err := strconv.ParseInt(lit, 0, 64)
+		return _int_type(i), err
+	case Uint:
+		u, err := strconv.ParseUint(lit, 0, 64)
+		return _uint_type(u), err
+	case Float:
+		f, err := strconv.ParseFloat(lit, 64)
+		return _float_type(f), err
+	case Complex:
+		c, err := strconv.ParseComplex(lit, 128)
+		return _complex_type(c), err
+	case String:
+		s, err := parseStringLiteral(lit)
+		return _string_type(s), err
+	case Bytes:
+		b, err := parseBytesLiteral(lit)
+		return _bytes_type(b), err
+	case Opaque:
+		b, err := parseBytesLiteral(lit)
+		if err != nil {
+			return nil, err
+		}
+		o := *v.(*opaqueEncodedValue)
+		o.value = b
+		o.decoded = decodeOpaque(o.name, b)
+		return &o, nil
+	case Slice, Map:
+		if lit != "nil" {
+			return nil, fmt.Errorf("can only set a %s to nil", v.Kind())
+		}
+		switch v := v.(type) {
+		case *sliceValue:
+			s := *v
+			s.values = nil
+			return &s, nil
+		case *mapValue:
+			m := *v
+			m.values = nil
+			m.sent = false
+			return &m, nil
+		}
+	}
+	return nil, fmt.Errorf("can't assign a literal to a %s", v.Kind())
+}
+
+// strings can be quoted Go strings or just the raw text
+func parseStringLiteral(lit string) (string, error) {
+	if len(lit) > 0 && (lit[0] == '"' || lit[0] == '`') {
+		return strconv.Unquote(lit)
+	}
+	return lit, nil
+}
+
+// bytes are either a quoted Go string or hex starting with 0x
+func parseBytesLiteral(lit string) ([]byte, error) {
+	if strings.HasPrefix(lit, "0x") {
+		return hex.DecodeString(lit[2:])
+	}
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return nil, errors.New("bytes must be a quoted string or hex starting with 0x")
+	}
+	return []byte(s), nil
+}
@@ -0,0 +1,101 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestSetStruct(t *testing.T) {
+	g := decodeFileTest("nestedstructfull.bin", t)[0]
+	for _, expr := range []string{".X=-20", `.W.C="abc"`, ".Z=world", ".W.B=(1+2i)", ".Y=0"} {
+		if err := g.SetExpr(expr); err != nil {
+			t.Fatalf("err: %v setting %s", err, expr)
+		}
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(g); err != nil {
+		t.Fatal("encoding", err)
+	}
+	var got Test
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal("decoding", err)
+	}
+	expected := Test{
+		W: Inner{A: 3.14, B: 1 + 2i, C: []byte("abc")},
+		X: -20,
+		Z: "world",
+	}
+	if got.X != expected.X || got.Y != expected.Y || got.Z != expected.Z ||
+		got.W.B != expected.W.B || !bytes.Equal(got.W.C, expected.W.C) {
+		t.Fatalf("expected %#v but got %#v", expected, got)
+	}
+}
+
+func TestSetContainers(t *testing.T) {
+	g := decodeFileTest("mapbuiltin.bin", t)[0]
+	if err := g.Set(`["one point two"]`, "2.4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Set(`["new"]`, "-1"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(g); err != nil {
+		t.Fatal("encoding", err)
+	}
+	var m map[string]float64
+	if err := gob.NewDecoder(&buf).Decode(&m); err != nil {
+		t.Fatal("decoding", err)
+	}
+	if m["one point two"] != 2.4 || m["new"] != -1 || m["negative ten point five"] != -10.5 {
+		t.Fatalf("unexpected map %v", m)
+	}
+
+	g = decodeFileTest("arraystruct.bin", t)[0]
+	if err := g.SetExpr("[2].Int=7"); err != nil {
+		t.Fatal(err)
+	}
+	cmp(g.Value.(ArrayValue).Index(2).Display(SingleLine), "Anon70{Float: 0, Int: 7}", t)
+
+	g = decodeFileTest("usermap.bin", t)[0]
+	if err := g.SetExpr(`["hi"]=99`); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetExpr(`["bye"]=nil`); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range g.Value.(MapValue).Entries() {
+		switch e.Key.(StringValue).String() {
+		case "hi":
+			cmp(e.Elem.Display(SingleLine), "99", t)
+		case "bye":
+			cmp(e.Elem.Display(SingleLine), "nil", t)
+		}
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	g := decodeFileTest("nestedstructfull.bin", t)[0]
+	for _, expr := range []string{
+		".X=ten",
+		".Nope=1",
+		".W=1",
+		".W.C[0]=1",
+		".Z[",
+		"X=1",
+		".X",
+	} {
+		if err := g.SetExpr(expr); err == nil {
+			t.Fatalf("expected an error setting %s", expr)
+		}
+	}
+	g = decodeFileTest("slicebuiltin.bin", t)[0]
+	if err := g.SetExpr("[3]=four"); err == nil {
+		t.Fatal("expected an out of range error")
+	}
+	g = decodeFileTest("usermap.bin", t)[0]
+	if err := g.SetExpr(`["new"]=1`); err == nil {
+		t.Fatal("can't add a key for an interface value")
+	}
+}
@@ -0,0 +1,470 @@
+package degob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder writes Gobs back out in the gob wire format so they can be read
+// with `encoding/gob`. Like a gob.Encoder it only sends each type once, so
+// use a single Encoder for everything written to the same stream.
+//
+// Types keep their original IDs unless another type on the stream already
+// used the ID, in which case they get a new one.
+type Encoder struct {
+	w    io.Writer
+	sent map[*WireType]TypeID // types that have been sent and the ID used
+	used map[TypeID]bool      // IDs that are taken on this stream
+	next TypeID               // where to start looking for a free ID
+
+	types   map[TypeID]*WireType // types of the Gob being encoded
+	pending [][]byte             // type definitions to send before the value
+	partial bool                 // types that aren't there keep their IDs
+}
+
+// NewEncoder returns an Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:    w,
+		sent: make(map[*WireType]TypeID),
+		used: make(map[TypeID]bool),
+		next: smallestUserTypeId,
+	}
+}
+
+// Encode writes the Gob's value to the stream along with any type
+// definitions that haven't been sent yet. Interface values are sent with
+// the name their concrete type was registered with so `encoding/gob` needs
+// the same registrations to decode them.
+func (enc *Encoder) Encode(g *Gob) error {
+	if g.Value == nil {
+		return errors.New("gob has no value")
+	}
+	enc.types = g.Types
+	enc.pending = enc.pending[:0]
+	orig, err := valueTypeID(g.Value)
+	if err != nil {
+		return err
+	}
+	w := enc.wireFor(orig, nil)
+	id, err := enc.typeID(orig, nil)
+	if err != nil {
+		return err
+	}
+	msg := appendUint(nil, intToUint(int64(id)))
+	if w != nil && w.StructT != nil {
+		msg, err = enc.encodeStruct(msg, w, g.Value)
+	} else {
+		// everything else is sent like a struct with one field
+		msg = appendUint(msg, 0)
+		msg, err = enc.encodeValue(msg, orig, nil, g.Value)
+	}
+	if err != nil {
+		return err
+	}
+	for _, def := range enc.pending {
+		if err := enc.writeMessage(def); err != nil {
+			return err
+		}
+	}
+	return enc.writeMessage(msg)
+}
+
+func (enc *Encoder) writeMessage(msg []byte) error {
+	b := appendUint(make([]byte, 0, len(msg)+uintByteSize+1), uint64(len(msg)))
+	_, err := enc.w.Write(append(b, msg...))
+	return err
+}
+
+// wireFor finds the WireType for an ID either in the Gob's types or in the
+// type table of the type that referred to it
+func (enc *Encoder) wireFor(id TypeID, from *WireType) *WireType {
+	if isBuiltin(id) {
+		return nil
+	}
+	if w, ok := enc.types[id]; ok {
+		return w
+	}
+	if from != nil {
+		return from.types[id]
+	}
+	return nil
+}
+
+// typeID returns the ID a type is sent as on this stream. The first time a
+// type is seen its definition, and the definitions of everything it refers
+// to, are queued to be sent.
+func (enc *Encoder) typeID(orig TypeID, from *WireType) (TypeID, error) {
+	if isBuiltin(orig) {
+		return orig, nil
+	}
+	w := enc.wireFor(orig, from)
+	if w == nil && enc.partial {
+		return orig, nil
+	}
+	if w == nil {
+		return 0, fmt.Errorf("gob refers to type %d which it doesn't define", orig)
+	}
+	if id, ok := enc.sent[w]; ok {
+		return id, nil
+	}
+	id := orig
+	if id < smallestUserTypeId || enc.used[id] {
+		for enc.used[enc.next] {
+			enc.next++
+		}
+		id = enc.next
+	}
+	enc.sent[w] = id
+	enc.used[id] = true
+
+	// reserve our spot before the types we refer to like gob does
+	idx := len(enc.pending)
+	enc.pending = append(enc.pending, nil)
+	def, err := enc.encodeWireType(appendUint(nil, intToUint(-int64(id))), w, id)
+	if err != nil {
+		return 0, err
+	}
+	enc.pending[idx] = def
+	return id, nil
+}
+
+// refID returns the stream ID for a type referred to by w
+func (enc *Encoder) refID(b []byte, orig TypeID, w *WireType) ([]byte, error) {
+	id, err := enc.typeID(orig, w)
+	if err != nil {
+		return b, err
+	}
+	return appendUint(b, intToUint(int64(id))), nil
+}
+
+// encodes the wireType struct from `encoding/gob`. Field numbers here
+// follow its definition.
+func (enc *Encoder) encodeWireType(b []byte, w *WireType, id TypeID) ([]byte, error) {
+	var err error
+	switch {
+	case w.ArrayT != nil:
+		b = appendUint(b, 1)
+		b = appendCommon(b, &w.ArrayT.CommonType, id, false)
+		b = appendUint(b, 1)
+		if b, err = enc.refID(b, w.ArrayT.Elem, w); err != nil {
+			return b, err
+		}
+		if w.ArrayT.Len != 0 {
+			b = appendUint(b, 1)
+			b = appendUint(b, intToUint(int64(w.ArrayT.Len)))
+		}
+	case w.SliceT != nil:
+		b = appendUint(b, 2)
+		b = appendCommon(b, &w.SliceT.CommonType, id, false)
+		b = appendUint(b, 1)
+		if b, err = enc.refID(b, w.SliceT.Elem, w); err != nil {
+			return b, err
+		}
+	case w.StructT != nil:
+		b = appendUint(b, 3)
+		b = appendCommon(b, &w.StructT.CommonType, id, w.StructT.anonymous)
+		if len(w.StructT.Field) > 0 {
+			b = appendUint(b, 1)
+			b = appendUint(b, uint64(len(w.StructT.Field)))
+			for _, f := range w.StructT.Field {
+				b = appendUint(b, 1)
+				b = appendString(b, f.wire())
+				b = appendUint(b, 1)
+				if b, err = enc.refID(b, f.Id, w); err != nil {
+					return b, err
+				}
+				b = appendUint(b, 0)
+			}
+		}
+	case w.MapT != nil:
+		b = appendUint(b, 4)
+		b = appendCommon(b, &w.MapT.CommonType, id, false)
+		b = appendUint(b, 1)
+		if b, err = enc.refID(b, w.MapT.Key, w); err != nil {
+			return b, err
+		}
+		b = appendUint(b, 1)
+		if b, err = enc.refID(b, w.MapT.Elem, w); err != nil {
+			return b, err
+		}
+	case w.GobEncoderT != nil:
+		b = appendUint(b, 5)
+		b = appendCommon(b, &w.GobEncoderT.CommonType, id, false)
+	case w.BinaryMarshalerT != nil:
+		b = appendUint(b, 6)
+		b = appendCommon(b, &w.BinaryMarshalerT.CommonType, id, false)
+	case w.TextMarshalerT != nil:
+		b = appendUint(b, 7)
+		b = appendCommon(b, &w.TextMarshalerT.CommonType, id, false)
+	default:
+		return b, fmt.Errorf("type %d is an empty WireType", id)
+	}
+	// end of the type and end of the wireType
+	return append(b, 0, 0), nil
+}
+
+func appendCommon(b []byte, c *CommonType, id TypeID, anonymous bool) []byte {
+	b = appendUint(b, 1)
+	if c.Name != "" && !anonymous {
+		b = appendUint(b, 1)
+		b = appendString(b, c.Name)
+		b = appendUint(b, 1)
+	} else {
+		// skipping the name field
+		b = appendUint(b, 2)
+	}
+	b = appendUint(b, intToUint(int64(id)))
+	return appendUint(b, 0)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// encodeValue encodes v as the type orig. from is the type that referred to
+// orig and is used to find it if the Gob doesn't have it.
+func (enc *Encoder) encodeValue(b []byte, orig TypeID, from *WireType, v Value) ([]byte, error) {
+	if isBuiltin(orig) {
+		return enc.encodeBuiltin(b, orig, v)
+	}
+	w := enc.wireFor(orig, from)
+	if w == nil {
+		return b, fmt.Errorf("gob refers to type %d which it doesn't define", orig)
+	}
+	var err error
+	switch {
+	case w.StructT != nil:
+		return enc.encodeStruct(b, w, v)
+	case w.SliceT != nil:
+		s, ok := v.(SliceValue)
+		if !ok {
+			return b, kindError(Slice, v)
+		}
+		b = appendUint(b, uint64(s.Len()))
+		for i := 0; i < s.Len() && err == nil; i++ {
+			b, err = enc.encodeValue(b, w.SliceT.Elem, w, s.Index(i))
+		}
+	case w.ArrayT != nil:
+		a, ok := v.(ArrayValue)
+		if !ok {
+			return b, kindError(Array, v)
+		}
+		b = appendUint(b, uint64(a.Len()))
+		for i := 0; i < a.Len() && err == nil; i++ {
+			b, err = enc.encodeValue(b, w.ArrayT.Elem, w, a.Index(i))
+		}
+	case w.MapT != nil:
+		m, ok := v.(MapValue)
+		if !ok {
+			return b, kindError(Map, v)
+		}
+		b = appendUint(b, uint64(m.Len()))
+		for _, e := range m.Entries() {
+			if b, err = enc.encodeValue(b, w.MapT.Key, w, e.Key); err != nil {
+				break
+			}
+			if b, err = enc.encodeValue(b, w.MapT.Elem, w, e.Elem); err != nil {
+				break
+			}
+		}
+	default:
+		o, ok := v.(OpaqueValue)
+		if !ok {
+			return b, kindError(Opaque, v)
+		}
+		b = appendUint(b, uint64(len(o.Bytes())))
+		b = append(b, o.Bytes()...)
+	}
+	return b, err
+}
+
+// zero valued fields aren't sent, just like gob
+func (enc *Encoder) encodeStruct(b []byte, w *WireType, v Value) ([]byte, error) {
+	s, ok := v.(StructValue)
+	if !ok {
+		return b, kindError(Struct, v)
+	}
+	var err error
+	last := -1
+	for i, f := range w.StructT.Field {
+		fv, ok := s.Field(f.Name)
+		if !ok || isZero(fv) {
+			continue
+		}
+		b = appendUint(b, uint64(i-last))
+		last = i
+		if b, err = enc.encodeValue(b, f.Id, w, fv); err != nil {
+			return b, fmt.Errorf("field %s.%s: %v", w.StructT.Name, f.Name, err)
+		}
+	}
+	return appendUint(b, 0), nil
+}
+
+func (enc *Encoder) encodeBuiltin(b []byte, id TypeID, v Value) ([]byte, error) {
+	switch id {
+	case BoolID:
+		x, ok := v.(BoolValue)
+		if !ok {
+			return b, kindError(Bool, v)
+		}
+		if x.Bool() {
+			return appendUint(b, 1), nil
+		}
+		return appendUint(b, 0), nil
+	case IntID:
+		x, ok := v.(IntValue)
+		if !ok {
+			return b, kindError(Int, v)
+		}
+		return appendUint(b, intToUint(x.Int())), nil
+	case UintID:
+		x, ok := v.(UintValue)
+		if !ok {
+			return b, kindError(Uint, v)
+		}
+		return appendUint(b, x.Uint()), nil
+	case FloatID:
+		x, ok := v.(FloatValue)
+		if !ok {
+			return b, kindError(Float, v)
+		}
+		return appendUint(b, floatToUint(x.Float())), nil
+	case ComplexID:
+		x, ok := v.(ComplexValue)
+		if !ok {
+			return b, kindError(Complex, v)
+		}
+		b = appendUint(b, floatToUint(real(x.Complex())))
+		return appendUint(b, floatToUint(imag(x.Complex()))), nil
+	case BytesID:
+		if v.Kind() != Bytes {
+			return b, kindError(Bytes, v)
+		}
+		x := v.(BytesValue).Bytes()
+		b = appendUint(b, uint64(len(x)))
+		return append(b, x...), nil
+	case StringID:
+		x, ok := v.(StringValue)
+		if !ok {
+			return b, kindError(String, v)
+		}
+		return appendString(b, x.String()), nil
+	default:
+		x, ok := v.(InterfaceValue)
+		if !ok {
+			return b, kindError(Interface, v)
+		}
+		return enc.encodeInterface(b, x)
+	}
+}
+
+// interfaces are the registered name, the concrete type ID and then the
+// value prefixed with its length
+func (enc *Encoder) encodeInterface(b []byte, v InterfaceValue) ([]byte, error) {
+	elem := v.Elem()
+	if elem == nil || elem.Kind() == Nil {
+		return appendUint(b, 0), nil
+	}
+	name := v.RegisteredName()
+	if name == "" {
+		return b, errors.New("interface value has no concrete type name")
+	}
+	b = appendString(b, name)
+	orig, err := valueTypeID(elem)
+	if err != nil {
+		return b, err
+	}
+	id, err := enc.typeID(orig, nil)
+	if err != nil {
+		return b, err
+	}
+	b = appendUint(b, intToUint(int64(id)))
+	var inner []byte
+	if w := enc.wireFor(orig, nil); w != nil && w.StructT != nil {
+		inner, err = enc.encodeStruct(inner, w, elem)
+	} else {
+		inner, err = enc.encodeValue(appendUint(inner, 0), orig, nil, elem)
+	}
+	if err != nil {
+		return b, err
+	}
+	b = appendUint(b, uint64(len(inner)))
+	return append(b, inner...), nil
+}
+
+// values of user defined types remember the ID they were decoded with
+type typedValue interface {
+	typeID() TypeID
+}
+
+func (v *structValue) typeID() TypeID        { return v.id }
+func (v sliceValue) typeID() TypeID          { return v.id }
+func (v arrayValue) typeID() TypeID          { return v.id }
+func (v mapValue) typeID() TypeID            { return v.id }
+func (v *opaqueEncodedValue) typeID() TypeID { return v.id }
+
+// valueTypeID returns the ID of the type of v
+func valueTypeID(v Value) (TypeID, error) {
+	switch v.Kind() {
+	case Bool:
+		return BoolID, nil
+	case Int:
+		return IntID, nil
+	case Uint:
+		return UintID, nil
+	case Float:
+		return FloatID, nil
+	case Complex:
+		return ComplexID, nil
+	case Bytes:
+		return BytesID, nil
+	case String:
+		return StringID, nil
+	case Interface:
+		return InterfaceID, nil
+	}
+	if t, ok := v.(typedValue); ok && t.typeID() != 0 {
+		return t.typeID(), nil
+	}
+	return 0, fmt.Errorf("%s value has no type", v.Kind())
+}
+
+func isZero(v Value) bool {
+	switch v.Kind() {
+	case Bool:
+		return !v.(BoolValue).Bool()
+	case Int:
+		return v.(IntValue).Int() == 0
+	case Uint:
+		return v.(UintValue).Uint() == 0
+	case Float:
+		return v.(FloatValue).Float() == 0
+	case Complex:
+		return v.(ComplexValue).Complex() == 0
+	case Bytes:
+		return len(v.(BytesValue).Bytes()) == 0
+	case String:
+		return v.(StringValue).String() == ""
+	case Slice:
+		return v.(SliceValue).Len() == 0
+	case Map:
+		// encoding/gob sends empty maps that aren't nil
+		if m, ok := v.(*mapValue); ok {
+			return !m.sent && len(m.values) == 0
+		}
+		return v.(MapValue).Len() == 0
+	case Interface:
+		elem := v.(InterfaceValue).Elem()
+		return elem == nil || elem.Kind() == Nil
+	case Nil:
+		return true
+	}
+	return false
+}
+
+func kindError(expected Kind, v Value) error {
+	return fmt.Errorf("expected a %s value but got %s", expected, v.Kind())
+}
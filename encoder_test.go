@@ -0,0 +1,167 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func encodeGobsTest(gobs []*Gob, t *testing.T) []byte {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, g := range gobs {
+		if err := enc.Encode(g); err != nil {
+			t.Fatalf("err: %v encoding %s", err, g.Display(SingleLine))
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	for _, obj := range testObjects {
+		var orig bytes.Buffer
+		fileToBufferTest(obj.fileName, &orig, t)
+		gobs := decodeFileTest(obj.fileName, t)
+		for _, g := range gobs {
+			g.Value = fixRegisteredNames(g.Value)
+		}
+		b := encodeGobsTest(gobs, t)
+
+		// encoding/gob has to agree with what we wrote
+		typ := reflect.TypeOf(obj.item)
+		expected := reflect.ValueOf(obj.item)
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+			expected = expected.Elem()
+		}
+		into := reflect.New(typ)
+		if err := gob.NewDecoder(bytes.NewReader(b)).DecodeValue(into); err != nil {
+			t.Fatalf("err: %v decoding re-encoded %s with encoding/gob", err, obj.fileName)
+		}
+		if !reflect.DeepEqual(into.Elem().Interface(), expected.Interface()) {
+			t.Fatalf("re-encoded %s decoded to %#v", obj.fileName, into.Elem().Interface())
+		}
+
+		// and so do we
+		again, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatalf("err: %v decoding re-encoded %s", err, obj.fileName)
+		}
+		compareGobs(obj.expected, again[0], obj.fileName, t)
+	}
+}
+
+// the test files were written by a build with a different import path so
+// the names types were registered with need to be changed to ours
+func fixRegisteredNames(v Value) Value {
+	switch v := v.(type) {
+	case interfaceValue:
+		if i := strings.LastIndex(v.registered, "."); i > 0 && strings.Contains(v.registered, "/") {
+			v.registered = reflect.TypeOf(Test{}).PkgPath() + v.registered[i:]
+		}
+		v.value = fixRegisteredNames(v.value)
+		return v
+	case *structValue:
+		for i := range v.fields {
+			v.fields[i].value = fixRegisteredNames(v.fields[i].value)
+		}
+	case *sliceValue:
+		for i := range v.values {
+			v.values[i] = fixRegisteredNames(v.values[i])
+		}
+	case *arrayValue:
+		for i := range v.values {
+			v.values[i] = fixRegisteredNames(v.values[i])
+		}
+	case *mapValue:
+		for i := range v.values {
+			v.values[i].key = fixRegisteredNames(v.values[i].key)
+			v.values[i].elem = fixRegisteredNames(v.values[i].elem)
+		}
+	}
+	return v
+}
+
+func TestEncoderSameBytes(t *testing.T) {
+	// without interfaces we should write exactly what encoding/gob did
+	for _, fname := range []string{"nestedstructfull.bin", "nestedstructempty.bin", "slicestruct.bin", "mapuserdefined.bin", "arraystruct.bin", "string.bin", "usermap.bin"} {
+		var orig bytes.Buffer
+		fileToBufferTest(fname, &orig, t)
+		b := encodeGobsTest(decodeFileTest(fname, t), t)
+		if !bytes.Equal(orig.Bytes(), b) {
+			t.Fatalf("re-encoding %s\nexpected % x\n     got % x", fname, orig.Bytes(), b)
+		}
+	}
+}
+
+type encoderMaps struct {
+	Empty map[string]int
+	Nil   map[string]int
+	Full  map[string]int
+}
+
+func TestEncoderEmptyMap(t *testing.T) {
+	// encoding/gob sends maps that are empty but not nil
+	orig := encodeTest(t, encoderMaps{Empty: map[string]int{}, Full: map[string]int{"a": 1}})
+	gobs, err := NewDecoder(bytes.NewReader(orig)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := encodeGobsTest(gobs, t); !bytes.Equal(orig, b) {
+		t.Fatalf("expected % x\n     got % x", orig, b)
+	}
+	// and setting one to nil leaves it out
+	if err := gobs[0].Set(".Empty", "nil"); err != nil {
+		t.Fatal(err)
+	}
+	if b := encodeGobsTest(gobs, t); len(b) >= len(orig) {
+		t.Fatalf("expected the nil map to be left out of % x", b)
+	}
+}
+
+type encoderSession struct {
+	Empty   struct{}
+	Name    string
+	Any     interface{}
+	Matrix  [][]int
+	Lookup  map[string]*ElemType
+	Options []interface{}
+}
+
+func TestEncoderSession(t *testing.T) {
+	gob.Register(encoderSession{})
+	values := []interface{}{
+		encoderSession{Name: "one", Any: Inner{A: 1}, Matrix: [][]int{{1}, {2, 3}}},
+		encoderSession{
+			Any:     encoderSession{Name: "nested", Any: SliceInner{Uint: 1}},
+			Lookup:  map[string]*ElemType{"a": &ElemType{Complex: 1i}},
+			Options: []interface{}{"x", 2, Test{X: 4}},
+		},
+		&Test{Z: "after"},
+	}
+	var orig bytes.Buffer
+	enc := gob.NewEncoder(&orig)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal("encoding", err)
+		}
+	}
+	gobs, err := NewDecoder(&orig).Decode()
+	if err != nil {
+		t.Fatal("decoding", err)
+	}
+	b := encodeGobsTest(gobs, t)
+
+	dec := gob.NewDecoder(bytes.NewReader(b))
+	for _, v := range values {
+		into := reflect.New(reflect.Indirect(reflect.ValueOf(v)).Type())
+		if err := dec.DecodeValue(into); err != nil {
+			t.Fatal("decoding re-encoded gob", err)
+		}
+		if !reflect.DeepEqual(into.Elem().Interface(), reflect.Indirect(reflect.ValueOf(v)).Interface()) {
+			t.Fatalf("expected %#v but got %#v", v, into.Elem().Interface())
+		}
+	}
+}
@@ -11,10 +11,29 @@ type Error struct {
 	Processed uint64
 	Err       error
 	RawGob    []byte
+
+	// Message is the index of the message in the stream that was being
+	// decoded, TypeID is the type that was being read and Path is where in
+	// it the decoder was, like Test.W.C[3] for a value or def 65.Field[1]
+	// for a type definition. They are set by Decode, DecodeLenient and
+	// DecodeStream.
+	Message int
+	TypeID  TypeID
+	Path    string
 }
 
 func (e *Error) Error() string {
-	return fmt.Sprintf("error: %v after processing %d bytes", e.Err, e.Processed)
+	s := fmt.Sprintf("error: %v after processing %d bytes", e.Err, e.Processed)
+	if e.Path != "" {
+		s += fmt.Sprintf(" (message %d, type %d at %s)", e.Message, e.TypeID, e.Path)
+	}
+	return s
+}
+
+// Unwrap returns the underlying error so errors.Is works with things like
+// io.ErrUnexpectedEOF and ErrMessageTooBig
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 func errGen(s string) func(uint64, []byte) *Error {
@@ -40,4 +59,9 @@ var (
 	errUnknownDelta      = errGen("found unexpected delta value when trying to decode type")
 	errCorruptCommonType = errGen("bad field number for CommonType")
 	errBadString         = errGen("failed to decode string")
+
+	// values of types that weren't defined, which Index.Decode looks for
+	errUnknownType    = errors.New("gob had value for unknown type")
+	errUnexpectedType = errors.New("unexpected type")
+	errExtraData      = errors.New("extra data at the end of a message")
 )
@@ -0,0 +1,103 @@
+package degob
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addExamples seeds the fuzzer with every gob in test_examples
+func addExamples(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("test_examples", "*.bin"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+}
+
+// checkErr makes sure malformed input comes back as an *Error
+func checkErr(t *testing.T, err error) {
+	if err == nil {
+		return
+	}
+	if _, ok := err.(*Error); !ok {
+		t.Fatalf("expected *Error got %T: %v", err, err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		dec := NewDecoder(bytes.NewReader(b))
+		dec.RecordSpans(true)
+		gobs, err := dec.DecodeLenient()
+		checkErr(t, err)
+		for _, g := range gobs {
+			g.WriteHexdump(io.Discard)
+			for _, sty := range []style{SingleLine, CommentedSingleLine, JSON} {
+				g.Value.Display(sty)
+			}
+			var buf bytes.Buffer
+			g.WriteTypes(&buf)
+		}
+		checkErr(t, NewDecoder(bytes.NewReader(b)).DecodeHandler(BaseHandler{}))
+	})
+}
+
+// FuzzGuessing is separate from FuzzDecode since guessing finds new
+// coverage in almost anything, which slows the other down
+func FuzzGuessing(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		gobs, err := NewDecoder(bytes.NewReader(b), WithGuessing()).DecodeLenient()
+		checkErr(t, err)
+		for _, g := range gobs {
+			g.Value.Display(SingleLine)
+		}
+	})
+}
+
+func FuzzDecodeStream(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		dec := NewDecoder(bytes.NewReader(b))
+		// results always have an *Error so this only checks for panics
+		for res := range dec.DecodeStream(nil, 0) {
+			if res.Gob != nil {
+				res.Gob.Value.Display(SingleLine)
+			}
+		}
+	})
+}
+
+func FuzzReadUint(f *testing.F) {
+	for _, v := range []uint64{0, 7, 0x7f, 0x80, 256, 1 << 32, ^uint64(0)} {
+		f.Add(appendUint(nil, v))
+	}
+	f.Add([]byte{0xf7, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var into [9]byte
+		var read uint64
+		v, width, err := readUint(bytes.NewReader(b), into[:], &read)
+		if err != nil {
+			return
+		}
+		if width > len(b) || read != uint64(width) {
+			t.Fatalf("read %d bytes with width %d from %d bytes", read, width, len(b))
+		}
+		// readUint accepts non minimal encodings so only check the value
+		var again [9]byte
+		got, _, err := readUint(bytes.NewReader(appendUint(nil, v)), again[:], &read)
+		if err != nil || got != v {
+			t.Fatalf("%d round tripped to %d: %v", v, got, err)
+		}
+	})
+}
@@ -0,0 +1,394 @@
+package degob
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteSource writes a gofmt'ed Go file for package pkg that declares the
+// types used by the gobs. The types are written in dependency order and the
+// concrete types found in interfaces are registered with `encoding/gob` in an
+// init function, so the file can be dropped into a project and used to decode
+// the original gobs.
+//
+// Anonymous structs and types whose names aren't Go identifiers are given
+// made up names. Unnamed slices, maps and arrays are written inline. The
+// GobEncoder, BinaryMarshaler and TextMarshaler types become []byte types that
+// marshal to and from their raw bytes. Struct fields narrowed by a Corpus are
+// written with the narrower type, and fields given types by Hints or a
+// Schema are written with those, along with the declarations of the Schema's
+// types they use that the gobs don't have. Types with the same name are only
+// written once and it is an error for two gobs to define the same name
+// differently.
+func WriteSource(w io.Writer, pkg string, gobs ...*Gob) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("%q isn't a valid package name", pkg)
+	}
+	gen := newGenerator()
+	for _, g := range gobs {
+		if err := gen.addGob(g); err != nil {
+			return err
+		}
+	}
+	src, err := format.Source(gen.source(pkg))
+	if err != nil {
+		return fmt.Errorf("generated source doesn't format: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+type generator struct {
+	// the type table of the gob being added
+	types map[TypeID]*WireType
+	// the type expression used for each type that has been seen
+	exprs map[*WireType]string
+	// types whose declaration is being written and types that turned out to
+	// refer back to themselves while that happened
+	writing   map[*WireType]bool
+	recursive map[*WireType]bool
+	// declarations in the order they are written out
+	decls []string
+	// declaration by name and anonymous struct names by body so the same
+	// struct isn't written twice
+	declared  map[string]string
+	anonymous map[string]string
+	// the lines of the init function
+	regs       []string
+	registered map[string]string // registered name to type
+	regTypes   map[string]string // type to registered name
+	// imports of the packages used by types from Hints and a Schema, and
+	// the declarations
+	// of the types from a Schema by name
+	imports     map[string]bool
+	schemaDecls map[string]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		exprs:       make(map[*WireType]string),
+		writing:     make(map[*WireType]bool),
+		recursive:   make(map[*WireType]bool),
+		declared:    make(map[string]string),
+		anonymous:   make(map[string]string),
+		registered:  make(map[string]string),
+		regTypes:    make(map[string]string),
+		imports:     make(map[string]bool),
+		schemaDecls: make(map[string]string),
+	}
+}
+
+func (gen *generator) addGob(g *Gob) error {
+	gen.types = g.Types
+	ids := make([]TypeID, 0, len(g.Types))
+	for id := range g.Types {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if _, err := gen.typeExpr(id); err != nil {
+			return err
+		}
+	}
+	if g.Value == nil {
+		return nil
+	}
+	return gen.registerValues(g.Value)
+}
+
+// typeExpr returns the Go expression for the type, declaring it first if it
+// needs to be
+func (gen *generator) typeExpr(id TypeID) (string, error) {
+	if id.IsBuiltin() {
+		return id.name(), nil
+	}
+	w, ok := gen.types[id]
+	if !ok || w.Kind() == Invalid {
+		return "", fmt.Errorf("type %d isn't defined", id)
+	}
+	if e, ok := gen.exprs[w]; ok {
+		if gen.writing[w] {
+			gen.recursive[w] = true
+		}
+		return e, nil
+	}
+	if gen.writing[w] {
+		// an unnamed slice, map or array that contains itself can't be
+		// written inline after all
+		gen.recursive[w] = true
+		gen.exprs[w] = gen.reserve(fmt.Sprintf("Anon%d", id))
+		return gen.exprs[w], nil
+	}
+	name := w.Common().Name
+	if w.Kind() == Struct || w.Kind() == Opaque || token.IsIdentifier(name) {
+		return gen.declare(id, w)
+	}
+	gen.writing[w] = true
+	body, err := gen.body(w)
+	delete(gen.writing, w)
+	if err != nil {
+		return "", err
+	}
+	if gen.recursive[w] {
+		name := gen.exprs[w]
+		gen.declared[name] = fmt.Sprintf("type %s %s", name, body)
+		gen.decls = append(gen.decls, gen.declared[name])
+		return name, nil
+	}
+	gen.exprs[w] = body
+	return body, nil
+}
+
+// declare writes out a named type declaration for w
+func (gen *generator) declare(id TypeID, w *WireType) (string, error) {
+	name := w.Common().Name
+	anonymous := !token.IsIdentifier(name) || (w.StructT != nil && w.StructT.anonymous)
+	if anonymous {
+		if !token.IsIdentifier(name) {
+			name = fmt.Sprintf("Anon%d", id)
+		}
+		name = gen.reserve(name)
+	}
+	gen.exprs[w] = name
+	gen.writing[w] = true
+	body, err := gen.body(w)
+	delete(gen.writing, w)
+	if err != nil {
+		return "", err
+	}
+	if anonymous && w.Kind() == Struct && !gen.recursive[w] {
+		// the same anonymous struct from another gob is given the name it
+		// had the first time
+		if prev, ok := gen.anonymous[body]; ok {
+			delete(gen.declared, name)
+			gen.exprs[w] = prev
+			return prev, nil
+		}
+		gen.anonymous[body] = name
+	}
+	decl := fmt.Sprintf("type %s %s", name, body)
+	if w.Kind() == Opaque {
+		decl = opaqueDecl(name, w)
+	}
+	if prev, ok := gen.declared[name]; ok && !anonymous {
+		if prev != decl {
+			return "", fmt.Errorf("type %s is defined differently by two gobs", name)
+		}
+		return name, nil
+	}
+	gen.declared[name] = decl
+	gen.decls = append(gen.decls, decl)
+	return name, nil
+}
+
+// reserve returns a name starting with base that hasn't been used
+func (gen *generator) reserve(base string) string {
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := gen.declared[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	gen.declared[name] = ""
+	return name
+}
+
+func (gen *generator) body(w *WireType) (string, error) {
+	switch w.Kind() {
+	case Struct:
+		var b strings.Builder
+		b.WriteString("struct {\n")
+		for _, f := range w.StructT.Field {
+			e, err := gen.typeExpr(f.Id)
+			if err != nil {
+				return "", err
+			}
+			// numbers can be narrowed by a Corpus and Hints and a Schema
+			// can give fields any type that holds what was sent
+			if narrowerType(f.Id, f.TypeString) {
+				e = f.TypeString
+			}
+			if f.hint != nil {
+				e = f.hint.expr
+				for _, imp := range f.hint.imports {
+					gen.imports[imp] = true
+				}
+				for name, decl := range f.hint.decls {
+					gen.schemaDecls[name] = decl
+				}
+			}
+			fmt.Fprintf(&b, "\t%s %s", f.Name, e)
+			if f.Comment != "" {
+				fmt.Fprintf(&b, " // %s", f.Comment)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}")
+		return b.String(), nil
+	case Slice:
+		elem, err := gen.typeExpr(w.SliceT.Elem)
+		return "[]" + elem, err
+	case Array:
+		elem, err := gen.typeExpr(w.ArrayT.Elem)
+		return fmt.Sprintf("[%d]%s", w.ArrayT.Len, elem), err
+	case Map:
+		key, err := gen.typeExpr(w.MapT.Key)
+		if err != nil {
+			return "", err
+		}
+		elem, err := gen.typeExpr(w.MapT.Elem)
+		return fmt.Sprintf("map[%s]%s", key, elem), err
+	case Opaque:
+		return "[]byte", nil
+	}
+	return "", errors.New("empty WireType")
+}
+
+// we don't know what an opaque type really holds so it keeps the bytes it
+// was encoded to
+func opaqueDecl(name string, w *WireType) string {
+	kind, enc, dec := "TextMarshaler", "MarshalText", "UnmarshalText"
+	switch {
+	case w.GobEncoderT != nil:
+		kind, enc, dec = "GobEncoder", "GobEncode", "GobDecode"
+	case w.BinaryMarshalerT != nil:
+		kind, enc, dec = "BinaryMarshaler", "MarshalBinary", "UnmarshalBinary"
+	}
+	return fmt.Sprintf(`// %[1]s was encoded as a %[2]s so only its raw bytes are known
+type %[1]s []byte
+
+func (x %[1]s) %[3]s() ([]byte, error) {
+	return x, nil
+}
+
+func (x *%[1]s) %[4]s(b []byte) error {
+	*x = append((*x)[:0], b...)
+	return nil
+}`, name, kind, enc, dec)
+}
+
+// registerValues registers the concrete types of all of the interfaces in v
+func (gen *generator) registerValues(v Value) error {
+	var err error
+	walkValues(v, func(v Value) bool {
+		iv, ok := v.(InterfaceValue)
+		if !ok {
+			return true
+		}
+		if elem := iv.Elem(); elem != nil && elem.Kind() != Nil {
+			err = gen.register(iv.RegisteredName(), elem)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (gen *generator) register(name string, v Value) error {
+	id, err := valueTypeID(v)
+	if err != nil {
+		return err
+	}
+	pointer := strings.HasPrefix(name, "*")
+	var typ string
+	if id.IsBuiltin() {
+		// encoding/gob registers the builtin types itself. Anything else is a
+		// named type with a builtin underlying type.
+		if !strings.Contains(name, ".") {
+			return nil
+		}
+		typ = strings.TrimPrefix(name[strings.LastIndex(name, ".")+1:], "*")
+		if !token.IsIdentifier(typ) {
+			return fmt.Errorf("can't make a type for interface value %s", name)
+		}
+		decl := fmt.Sprintf("type %s %s", typ, id.name())
+		if prev, ok := gen.declared[typ]; ok {
+			if prev != decl {
+				return fmt.Errorf("type %s is defined differently by two gobs", typ)
+			}
+		} else {
+			gen.declared[typ] = decl
+			gen.decls = append(gen.decls, decl)
+		}
+	} else {
+		typ, err = gen.typeExpr(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	var zero string
+	switch {
+	case pointer:
+		typ = "*" + typ
+		zero = fmt.Sprintf("new(%s)", typ[1:])
+	case id.IsBuiltin():
+		zero = fmt.Sprintf("*new(%s)", typ)
+	default:
+		zero = typ + "{}"
+	}
+	if prev, ok := gen.registered[name]; ok {
+		if prev != typ {
+			return fmt.Errorf("%s is registered as both %s and %s", name, prev, typ)
+		}
+		return nil
+	}
+	gen.registered[name] = typ
+	if prev, ok := gen.regTypes[typ]; ok {
+		// encoding/gob panics if a type is registered twice
+		gen.regs = append(gen.regs, fmt.Sprintf("// gob.RegisterName(%q, %s) %s is already registered as %q", name, zero, typ, prev))
+		return nil
+	}
+	gen.regTypes[typ] = name
+	gen.regs = append(gen.regs, fmt.Sprintf("gob.RegisterName(%q, %s)", name, zero))
+	return nil
+}
+
+func (gen *generator) source(pkg string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by degob. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(gen.regs) > 0 {
+		gen.imports[`"encoding/gob"`] = true
+	}
+	imports := make([]string, 0, len(gen.imports))
+	for imp := range gen.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "import %s\n", imp)
+	}
+	if len(imports) > 0 {
+		b.WriteString("\n")
+	}
+	// the gobs' own types come first if they have the same names
+	names := make([]string, 0, len(gen.schemaDecls))
+	for name := range gen.schemaDecls {
+		if _, ok := gen.declared[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gen.decls = append(gen.decls, gen.schemaDecls[name])
+	}
+	for _, d := range gen.decls {
+		b.WriteString(d)
+		b.WriteString("\n\n")
+	}
+	if len(gen.regs) > 0 {
+		b.WriteString("func init() {\n")
+		for _, r := range gen.regs {
+			b.WriteString(r)
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,157 @@
+package degob
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func genSourceTest(t *testing.T, files ...string) string {
+	var gobs []*Gob
+	for _, f := range files {
+		gobs = append(gobs, decodeFileTest(f, t)...)
+	}
+	var buf bytes.Buffer
+	if err := WriteSource(&buf, "gobs", gobs...); err != nil {
+		t.Fatalf("failed to write source for %v: %v", files, err)
+	}
+	return buf.String()
+}
+
+func TestWriteSource(t *testing.T) {
+	src := genSourceTest(t, "nestedstructfull.bin")
+	cmp(src, `// Code generated by degob. DO NOT EDIT.
+
+package gobs
+
+type Inner struct {
+	A float64
+	B complex128
+	C []byte
+}
+
+type Test struct {
+	W Inner
+	X int64
+	Y uint64
+	Z string
+}
+`, t)
+}
+
+func TestWriteSourceMerge(t *testing.T) {
+	src := genSourceTest(t, "slicestruct.bin", "interfacemap.bin", "usermap.bin")
+	if n := strings.Count(src, "type SliceInner struct"); n != 1 {
+		t.Fatalf("expected SliceInner to be declared once but it was %d times:\n%s", n, src)
+	}
+	for _, s := range []string{
+		"import \"encoding/gob\"",
+		"type UserMap map[string]interface{}",
+		"gob.RegisterName(\"github.com/drosseau/degob.ArrayInner\", ArrayInner{})",
+		"gob.RegisterName(\"github.com/drosseau/degob.SliceInner\", SliceInner{})",
+	} {
+		if !strings.Contains(src, s) {
+			t.Errorf("expected %q in:\n%s", s, src)
+		}
+	}
+}
+
+func TestWriteSourceConflict(t *testing.T) {
+	a := decodeFileTest("nestedstructfull.bin", t)
+	b := decodeFileTest("nestedstructfull.bin", t)
+	b[0].Types[65].StructT.Field[0].Name = "Other"
+	err := WriteSource(&bytes.Buffer{}, "gobs", append(a, b...)...)
+	if err == nil || !strings.Contains(err.Error(), "Test") {
+		t.Fatalf("expected an error about Test being defined twice but got %v", err)
+	}
+	if err := WriteSource(&bytes.Buffer{}, "not a package"); err == nil {
+		t.Fatal("expected an error for a bad package name")
+	}
+}
+
+func TestWriteSourceOpaque(t *testing.T) {
+	g := &Gob{
+		Types: map[TypeID]*WireType{
+			65: {StructT: &StructType{
+				CommonType: CommonType{Name: "Event", Id: 65},
+				Field:      []*FieldType{{Name: "When", Id: 66}},
+			}},
+			66: {GobEncoderT: &GobEncoderType{CommonType{Name: "Time", Id: 66}}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteSource(&buf, "gobs", g); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"type Time []byte",
+		"func (x Time) GobEncode() ([]byte, error)",
+		"func (x *Time) GobDecode(b []byte) error",
+		"When Time",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, buf.String())
+		}
+	}
+}
+
+// the whole point is that encoding/gob can decode the original gobs with the
+// generated types so build a program that does that
+func TestWriteSourceDecodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	roots := map[string]string{
+		"nestedstructfull.bin":  "Test",
+		"slicestruct.bin":       "[]SliceInner",
+		"interfacemap.bin":      "map[interface{}]interface{}",
+		"interfaceswithnil.bin": "map[interface{}]interface{}",
+		"allpointers.bin":       "AllPointers",
+		"usermap.bin":           "UserMap",
+		"arraybuiltin.bin":      "[5]int64",
+	}
+	var files []string
+	for f := range roots {
+		files = append(files, f)
+	}
+	src := genSourceTest(t, files...)
+	src = strings.Replace(src, "package gobs", "package main", 1)
+
+	dir := t.TempDir()
+	main := "package main\n\nimport (\n\t\"encoding/gob\"\n\t\"os\"\n)\n\nfunc main() {\n"
+	for f, root := range roots {
+		path, err := filepath.Abs(filepath.Join("test_examples", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		main += "\t{\n"
+		main += "\t\tf, err := os.Open(" + strconv.Quote(path) + ")\n"
+		main += "\t\tif err != nil {\n\t\t\tpanic(err)\n\t\t}\n"
+		main += "\t\tvar v " + root + "\n"
+		main += "\t\tif err := gob.NewDecoder(f).Decode(&v); err != nil {\n\t\t\tpanic(" + strconv.Quote(f+": ") + " + err.Error())\n\t\t}\n"
+		main += "\t}\n"
+	}
+	main += "}\n"
+	for name, contents := range map[string]string{
+		"go.mod":   "module gentest\n\ngo 1.20\n",
+		"types.go": src,
+		"main.go":  main,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated source failed: %v\n%s\n%s", err, out, src)
+	}
+}
@@ -4,13 +4,31 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 )
 
 // Gob is a more concrete representation of a gob. It has all of the found
 // types and the decoded value.
 type Gob struct {
-	Types map[typeId]*WireType
+	// Types are the types the value uses. They are the Gob's own and
+	// don't change when the Decoder goes on to the next one.
+	Types map[TypeID]*WireType
 	Value
+
+	// Partial is set on the last Gob from DecodeLenient if there was an error
+	// reading its value. Whatever wasn't read is an Unread value.
+	Partial bool
+
+	// Offset is where the gob starts in the stream, Raw is its bytes and
+	// Spans says what they mean. They are only set for a Decoder made
+	// WithSpans.
+	Offset int64
+	Raw    []byte
+	Spans  []Span
+
+	// Guesses are the parts of the value whose types were never defined
+	// and were guessed, if the Decoder was made WithGuessing
+	Guesses []Guess
 }
 
 // WriteTypes writes the Gob's types to Writer
@@ -18,7 +36,13 @@ func (g *Gob) WriteTypes(w io.Writer) error {
 	if g.Types == nil {
 		return errors.New("gob has no defined types")
 	}
-	for _, t := range g.Types {
+	ids := make([]TypeID, 0, len(g.Types))
+	for id := range g.Types {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		t := g.Types[id]
 		_, err := fmt.Fprintf(w, "// type ID: %d\n", t.Id())
 		if err != nil {
 			return err
@@ -0,0 +1,307 @@
+package degob
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Confidence is how likely a Guess is to be right
+type Confidence uint8
+
+const (
+	LowConfidence Confidence = iota
+	MediumConfidence
+	HighConfidence
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case HighConfidence:
+		return "high"
+	case MediumConfidence:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// Guess is a part of a Value whose type was never defined, so what it is
+// was guessed from its bytes. See WithGuessing.
+type Guess struct {
+	// Path is where it is in the Gob's value, in the same form as the Path
+	// of an Error
+	Path       string
+	Kind       Kind
+	Confidence Confidence
+}
+
+const (
+	// values bigger than this are left as bytes rather than searched
+	maxGuessBytes = 1 << 14
+	// how many readings of the bytes are tried before giving up, and
+	// how many for each byte so lots of small values don't take long
+	maxGuessSteps  = 1 << 14
+	guessByteSteps = 32
+	// the most fields a guessed struct can have
+	maxGuessFields = 1 << 10
+)
+
+// WithGuessing makes the Decoder guess what values of types it never saw
+// defined are instead of failing, which happens with captures that start
+// after the types were sent. The bytes are read as structs of field deltas
+// followed by numbers, strings, byte slices and more structs, with fields
+// named F0, F1 and so on after their field numbers. Each guess is in the
+// Gob's Guesses.
+//
+// Only values whose length is known can be guessed: the values of whole
+// messages and the concrete values in interfaces. Whatever can't be made
+// sense of is left as bytes. Handlers get a guessed value whole as a
+// Scalar.
+func WithGuessing() Option {
+	return func(dec *Decoder) {
+		dec.guess = true
+	}
+}
+
+// guessValue reads the next n bytes as a value of the undefined type id
+func (dec *Decoder) guessValue(id TypeID, n int) {
+	start := dec.pos()
+	b := dec.readBytes(n)
+	if dec.err != nil {
+		return
+	}
+	g := &guesser{b: b, steps: guessByteSteps * len(b)}
+	if g.steps > maxGuessSteps {
+		g.steps = maxGuessSteps
+	}
+	v, guesses := g.top(dec.getName(id))
+	if s, ok := v.(*structValue); ok {
+		s.id = id
+	}
+	dec.spanFrom(start, "guessed %s", v.Kind())
+	path := dec.state()
+	for _, guess := range guesses {
+		guess.Path = path + guess.Path
+		dec.guesses = append(dec.guesses, guess)
+	}
+	dec.scalar(v)
+}
+
+// guesser tries readings of b until one of them uses all of it. Each step
+// calls its continuation with what it read, where that ended and the
+// guesses in it with their paths relative to it, and backs up to try
+// something else if the continuation returns false.
+type guesser struct {
+	b        []byte
+	steps    int    // how many more can be tried
+	maxDelta uint64 // the biggest gap between field numbers
+}
+
+type guessed func(v Value, guesses []Guess, next int) bool
+
+func (g *guesser) top(name string) (Value, []Guess) {
+	var v Value
+	var guesses []Guess
+	end := func(gv Value, gs []Guess, next int) bool {
+		if next != len(g.b) {
+			return false
+		}
+		v, guesses = gv, gs
+		return true
+	}
+	if len(g.b) <= maxGuessBytes {
+		// everything but a struct is sent like a struct with one field
+		if len(g.b) > 1 && g.b[0] == 0 && g.elem(1, name, end) {
+			return v, guesses
+		}
+		// most structs don't skip many fields at once so readings that
+		// do are only tried if there's nothing else
+		for _, g.maxDelta = range []uint64{4, 16, 64, maxGuessFields} {
+			if g.structAt(0, name, false, end) {
+				return v, guesses
+			}
+		}
+	}
+	return _bytes_type(g.b), []Guess{{Kind: Bytes, Confidence: LowConfidence}}
+}
+
+// uint reads the uint at p
+func (g *guesser) uint(p int) (uint64, int, bool) {
+	if p >= len(g.b) {
+		return 0, 0, false
+	}
+	b := g.b[p]
+	if b <= 0x7f {
+		return uint64(b), 1, true
+	}
+	n := -int(int8(b))
+	if n > uintByteSize || p+1+n > len(g.b) {
+		return 0, 0, false
+	}
+	var x uint64
+	for _, c := range g.b[p+1 : p+1+n] {
+		x = x<<8 | uint64(c)
+	}
+	return x, n + 1, true
+}
+
+// elem guesses the field value at p. Fields with zero values aren't sent so
+// it is never a zero or empty.
+func (g *guesser) elem(p int, name string, k guessed) bool {
+	if g.steps--; g.steps < 0 {
+		return false
+	}
+	n, w, ok := g.uint(p)
+	if !ok || n == 0 {
+		return false
+	}
+	fits := n <= uint64(len(g.b)-p-w)
+	if fits {
+		// looking through long strings costs more than the other steps
+		g.steps -= int(n) >> 6
+		s := g.b[p+w : p+w+int(n)]
+		if printable(s) && g.iface(p+w+int(n), string(s), k) {
+			return true
+		}
+		if printable(s) {
+			conf := MediumConfidence
+			if n >= 3 {
+				conf = HighConfidence
+			}
+			if k(_string_type(s), []Guess{{Kind: String, Confidence: conf}}, p+w+int(n)) {
+				return true
+			}
+		} else if n >= 4 && k(_bytes_type(s), []Guess{{Kind: Bytes, Confidence: MediumConfidence}}, p+w+int(n)) {
+			return true
+		}
+	}
+	if num := guessNumber(n, w); k(num, []Guess{{Kind: num.Kind(), Confidence: MediumConfidence}}, p+w) {
+		return true
+	}
+	// complex numbers are two floats, either of which can be 0
+	if im, iw, ok := g.uint(p + w); ok {
+		re, rok := guessFloat(n, w)
+		i, iok := guessFloat(im, iw)
+		if (rok || n == 0) && (iok || im == 0) {
+			c := _complex_type(complex(re, i))
+			if k(c, []Guess{{Kind: Complex, Confidence: LowConfidence}}, p+w+iw) {
+				return true
+			}
+		}
+	}
+	if g.structAt(p, name, true, k) {
+		return true
+	}
+	if fits && n < 4 && !printable(g.b[p+w:p+w+int(n)]) {
+		return k(_bytes_type(g.b[p+w:p+w+int(n)]), []Guess{{Kind: Bytes, Confidence: LowConfidence}}, p+w+int(n))
+	}
+	return false
+}
+
+// structAt guesses the fields of a struct starting at p up to the 0 that
+// ends it. A struct in a field has at least one field since it wouldn't
+// have been sent otherwise.
+func (g *guesser) structAt(p int, name string, nested bool, k guessed) bool {
+	v := &structValue{name: name}
+	var guesses []Guess
+	var fields func(p, field int) bool
+	fields = func(p, field int) bool {
+		delta, w, ok := g.uint(p)
+		if !ok {
+			return false
+		}
+		if delta == 0 {
+			if nested && len(v.fields) == 0 {
+				return false
+			}
+			conf := MediumConfidence
+			if len(v.fields) < 2 {
+				conf = LowConfidence
+			}
+			all := append([]Guess{{Kind: Struct, Confidence: conf}}, guesses...)
+			return k(v, all, p+w)
+		}
+		if delta > g.maxDelta || field+int(delta) >= maxGuessFields {
+			return false
+		}
+		f := field + int(delta)
+		fname := "F" + strconv.Itoa(f)
+		return g.elem(p+w, name+"_"+fname, func(fv Value, gs []Guess, next int) bool {
+			v.fields = append(v.fields, structField{name: fname, value: fv})
+			n := len(guesses)
+			for _, guess := range gs {
+				guess.Path = "." + fname + guess.Path
+				guesses = append(guesses, guess)
+			}
+			if fields(next, f) {
+				return true
+			}
+			v.fields = v.fields[:len(v.fields)-1]
+			guesses = guesses[:n]
+			return false
+		})
+	}
+	return fields(p, -1)
+}
+
+// iface guesses that the string before p was the name of the concrete type
+// in an interface, which is followed by its type ID and the length of its
+// value
+func (g *guesser) iface(p int, name string, k guessed) bool {
+	id, w, ok := g.uint(p)
+	if !ok || uintToInt(id) <= 0 {
+		return false
+	}
+	p += w
+	n, w, ok := g.uint(p)
+	if !ok || n == 0 || n > uint64(len(g.b)-p-w) {
+		return false
+	}
+	p += w
+	inner := &guesser{b: g.b[p : p+int(n)], steps: g.steps}
+	v, gs := inner.top(interfaceName(name))
+	g.steps = inner.steps
+	guesses := []Guess{{Kind: Interface, Confidence: HighConfidence}}
+	for _, guess := range gs {
+		guess.Path = ".(" + interfaceName(name) + ")" + guess.Path
+		guesses = append(guesses, guess)
+	}
+	iv := interfaceValue{name: interfaceName(name), registered: name, value: v}
+	return k(iv, guesses, p+int(n))
+}
+
+// guessNumber is a uint unless it is a float
+func guessNumber(n uint64, w int) Value {
+	if f, ok := guessFloat(n, w); ok {
+		return _float_type(f)
+	}
+	return _uint_type(n)
+}
+
+// guessFloat reports whether n is two or more bytes that make a float with
+// a sensible size when they are reversed the way gob sends floats. A single
+// byte is much more likely to be a small number.
+func guessFloat(n uint64, w int) (float64, bool) {
+	if w < 3 {
+		return 0, false
+	}
+	f := math.Float64frombits(bits.ReverseBytes64(n))
+	a := math.Abs(f)
+	return f, a >= 1e-9 && a <= 1e15
+}
+
+// printable is text that is probably a string
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
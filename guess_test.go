@@ -0,0 +1,106 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestGuessing(t *testing.T) {
+	type Inner struct {
+		A string
+		B uint
+	}
+	type T struct {
+		Name  string
+		Count int
+		In    Inner
+		Data  []byte
+		F     float64
+		I     interface{}
+	}
+	gob.RegisterName("guessInner", Inner{})
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []T{
+		{Name: "x"},
+		{Name: "hello", Count: -10, In: Inner{"abc", 7}, Data: []byte{1, 2, 3, 4, 5, 200}, F: 3.14, I: Inner{"in", 2}},
+		{Name: "hi", Count: 3, In: Inner{B: 9}, I: "s"},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a capture that missed the first gob and the types with it
+	ix, err := NewIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ix.Messages[len(ix.Messages)-1].TypeID
+	second := ix.Messages[ix.Values(id)[1]]
+	later := buf.Bytes()[second.Offset:]
+	if _, err := NewDecoder(bytes.NewReader(later)).Decode(); err == nil {
+		t.Fatal("expected an error without guessing")
+	}
+	gobs, err := NewDecoder(bytes.NewReader(later), WithGuessing()).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := id.name()
+	expected := []string{
+		name + `{F0: "hello", F1: 19, F2: ` + name + `_F2{F0: "abc", F1: 7}, F3: []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0xc8}, F4: 3.14, F5: guessInner{F0: "in", F1: 2}}`,
+		name + `{F0: "hi", F1: 6, F2: ` + name + `_F2{F1: 9}, F5: "s"}`,
+	}
+	if len(gobs) != len(expected) {
+		t.Fatalf("expected %d gobs got %d", len(expected), len(gobs))
+	}
+	for i, g := range gobs {
+		if got := g.Value.Display(SingleLine); got != expected[i] {
+			t.Fatalf("expected\n%s\ngot\n%s", expected[i], got)
+		}
+	}
+	guesses := make(map[string]Guess)
+	for _, g := range gobs[0].Guesses {
+		guesses[g.Path] = g
+	}
+	for path, expected := range map[string]Guess{
+		name:                         {Kind: Struct, Confidence: MediumConfidence},
+		name + ".F0":                 {Kind: String, Confidence: HighConfidence},
+		name + ".F1":                 {Kind: Uint, Confidence: MediumConfidence},
+		name + ".F3":                 {Kind: Bytes, Confidence: MediumConfidence},
+		name + ".F4":                 {Kind: Float, Confidence: MediumConfidence},
+		name + ".F5":                 {Kind: Interface, Confidence: HighConfidence},
+		name + ".F5.(guessInner).F0": {Kind: String, Confidence: MediumConfidence},
+		name + ".F2.F0":              {Kind: String, Confidence: HighConfidence},
+	} {
+		expected.Path = path
+		if guesses[path] != expected {
+			t.Fatalf("expected %+v got %+v", expected, guesses[path])
+		}
+	}
+	if len(gobs[0].Guesses) != 12 {
+		t.Fatalf("expected 12 guesses got %+v", gobs[0].Guesses)
+	}
+
+	// Handlers get them whole
+	h := new(recordHandler)
+	if err := NewDecoder(bytes.NewReader(later), WithGuessing()).DecodeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.events) != 6 || h.events[1] != expected[0] {
+		t.Fatalf("expected the guesses as scalars got %q", h.events)
+	}
+}
+
+func TestGuessingFallback(t *testing.T) {
+	// type 65 with bytes that aren't a struct
+	data := []byte{6, 0xff, 0x82, 0xff, 0xff, 0xff, 0xff}
+	gobs, err := NewDecoder(bytes.NewReader(data), WithGuessing()).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gobs[0]
+	if g.Value.Kind() != Bytes || len(g.Guesses) != 1 || g.Guesses[0].Confidence != LowConfidence {
+		t.Fatalf("expected low confidence bytes got %s %+v", g.Value.Display(SingleLine), g.Guesses)
+	}
+}
@@ -0,0 +1,337 @@
+package degob
+
+import "io"
+
+// Handler gets the parts of the gobs as they are decoded instead of the
+// Decoder building a whole Value for each one, which is wasteful when only
+// a few fields of a huge gob are wanted. Use it with DecodeHandler.
+//
+// The methods ending in Start are followed by the values inside and then
+// End. If they return false that subtree is still read, since a gob can't
+// be skipped through without reading it, but nothing in it is sent to the
+// Handler and no End is sent for it. StructFieldStart and MapEntry skip
+// the field or entry the same way but there is no End for them.
+//
+// After an error nothing more is sent except MessageEnd.
+type Handler interface {
+	// TypeDefined is called with every type definition once it is read.
+	// The WireTypes given to a Handler are the Decoder's, which goes on
+	// naming them and the types they refer to, so they shouldn't be used
+	// after the call returns. Decoder.Types has copies that can be.
+	TypeDefined(w *WireType)
+	// MessageStart is called before the value of each gob with its type
+	// and MessageEnd after it, even if there was an error
+	MessageStart(id TypeID)
+	MessageEnd()
+	// StructStart is followed by a StructFieldStart before the value of
+	// every field that was sent
+	StructStart(w *WireType) bool
+	StructFieldStart(name string, id TypeID) bool
+	// SliceStart and ArrayStart are followed by their n elements
+	SliceStart(w *WireType, n int) bool
+	ArrayStart(w *WireType, n int) bool
+	// MapStart is followed by a MapEntry and then the key and element of
+	// each of its n entries
+	MapStart(w *WireType, n int) bool
+	MapEntry(i int) bool
+	// InterfaceStart has the name the concrete type was registered with
+	// and is followed by its value
+	InterfaceStart(name string) bool
+	// Scalar is every value that doesn't have parts: the builtin types,
+	// nil interfaces and the opaque values of GobEncoders and such. Values
+	// guessed WithGuessing come whole as well.
+	Scalar(v Value)
+	End()
+}
+
+// BaseHandler does nothing with anything and wants every subtree. Embed it
+// in a Handler to only write the methods that matter.
+type BaseHandler struct{}
+
+func (BaseHandler) TypeDefined(*WireType)                {}
+func (BaseHandler) MessageStart(TypeID)                  {}
+func (BaseHandler) MessageEnd()                          {}
+func (BaseHandler) StructStart(*WireType) bool           { return true }
+func (BaseHandler) StructFieldStart(string, TypeID) bool { return true }
+func (BaseHandler) SliceStart(*WireType, int) bool       { return true }
+func (BaseHandler) ArrayStart(*WireType, int) bool       { return true }
+func (BaseHandler) MapStart(*WireType, int) bool         { return true }
+func (BaseHandler) MapEntry(int) bool                    { return true }
+func (BaseHandler) InterfaceStart(string) bool           { return true }
+func (BaseHandler) Scalar(Value)                         {}
+func (BaseHandler) End()                                 {}
+
+// DecodeHandler decodes everything on the reader into h instead of making
+// Gobs. The error is an *Error like the one from Decode.
+func (dec *Decoder) DecodeHandler(h Handler) error {
+	dec.h = h
+	defer func() {
+		dec.h = dec.tree
+	}()
+	dec.bytesProcessed = 0
+	dec.streamPos = 0
+	dec.messages = 0
+	dec.clearGob()
+	for {
+		dec.getGobPiece()
+		if dec.err != nil {
+			if dec.err.Err == io.EOF {
+				return nil
+			}
+			dec.locateErr()
+			return dec.err
+		}
+		dec.decodeGobPiece()
+		if dec.err != nil {
+			dec.locateErr()
+			return dec.err
+		}
+		// a message with a value is the end of a gob
+		if dec.inValue {
+			dec.clearGob()
+		}
+	}
+}
+
+// begin sends the start of a struct, slice, array, map or interface to
+// the Handler unless it is in a subtree the Handler didn't want. Every
+// begin has an end.
+func (dec *Decoder) begin(start func(Handler) bool) {
+	if dec.err != nil {
+		return
+	}
+	if dec.quiet > 0 || !start(dec.h) {
+		dec.quiet++
+	}
+}
+
+func (dec *Decoder) end() {
+	if dec.err != nil {
+		return
+	}
+	if dec.quiet > 0 {
+		dec.quiet--
+		return
+	}
+	dec.h.End()
+}
+
+// structField and mapEntry return whether the Handler didn't want what
+// comes next, which unquiet takes back after it is read
+func (dec *Decoder) structField(name string, id TypeID) bool {
+	if dec.err != nil || dec.quiet > 0 || dec.h.StructFieldStart(name, id) {
+		return false
+	}
+	dec.quiet++
+	return true
+}
+
+func (dec *Decoder) mapEntry(i int) bool {
+	if dec.err != nil || dec.quiet > 0 || dec.h.MapEntry(i) {
+		return false
+	}
+	dec.quiet++
+	return true
+}
+
+func (dec *Decoder) unquiet(skipped bool) {
+	if skipped && dec.quiet > 0 {
+		dec.quiet--
+	}
+}
+
+func (dec *Decoder) scalar(v Value) {
+	if dec.err == nil && dec.quiet == 0 {
+		dec.h.Scalar(v)
+	}
+}
+
+// treeBuilder is the Handler that makes the Values in Gobs
+type treeBuilder struct {
+	BaseHandler
+	dec   *Decoder
+	root  Value
+	stack []*building
+}
+
+// building is a value with parts that are still being read
+type building struct {
+	v     Value          // the struct, slice, array or map
+	iface interfaceValue // or the interface if v is nil
+	n     int            // elements in a slice or map
+	field int            // the struct field being read
+	set   bool           // whether it has been
+	next  int            // the next array element
+	entry bool           // a map entry is being read
+	key   Value          // the key of it once it has been
+	child bool           // what was being read inside was closed by finish
+}
+
+func (b *treeBuilder) MessageStart(TypeID) {
+	b.root = nil
+	b.stack = b.stack[:0]
+}
+
+func (b *treeBuilder) MessageEnd() {
+	if b.dec.err != nil {
+		b.finish()
+	}
+	b.dec.decodedValue = b.root
+}
+
+func (b *treeBuilder) StructStart(w *WireType) bool {
+	v := b.dec.valueForWireType(w).(*structValue)
+	b.put(v)
+	b.stack = append(b.stack, &building{v: v, field: -1})
+	return true
+}
+
+func (b *treeBuilder) StructFieldStart(name string, id TypeID) bool {
+	top := b.stack[len(b.stack)-1]
+	for i, f := range top.v.(*structValue).fields {
+		if f.name == name {
+			top.field = i
+			top.set = false
+		}
+	}
+	return true
+}
+
+func (b *treeBuilder) SliceStart(w *WireType, n int) bool {
+	v := b.dec.valueForWireType(w).(*sliceValue)
+	v.values = make([]Value, 0, b.dec.elemCap(n))
+	b.put(v)
+	b.stack = append(b.stack, &building{v: v, n: n})
+	return true
+}
+
+func (b *treeBuilder) ArrayStart(w *WireType, n int) bool {
+	v := b.dec.valueForWireType(w).(*arrayValue)
+	if b.dec.err != nil {
+		return true
+	}
+	b.put(v)
+	b.stack = append(b.stack, &building{v: v, n: n})
+	return true
+}
+
+func (b *treeBuilder) MapStart(w *WireType, n int) bool {
+	v := b.dec.valueForWireType(w).(*mapValue)
+	v.values = make([]mapEntry, 0, b.dec.elemCap(n))
+	v.sent = true
+	b.put(v)
+	b.stack = append(b.stack, &building{v: v, n: n})
+	return true
+}
+
+func (b *treeBuilder) MapEntry(int) bool {
+	top := b.stack[len(b.stack)-1]
+	top.entry = true
+	top.key = nil
+	return true
+}
+
+func (b *treeBuilder) InterfaceStart(name string) bool {
+	b.stack = append(b.stack, &building{iface: interfaceValue{
+		name:       interfaceName(name),
+		registered: name,
+	}})
+	return true
+}
+
+func (b *treeBuilder) Scalar(v Value) {
+	b.put(v)
+}
+
+func (b *treeBuilder) End() {
+	top := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	// interfaces aren't pointers so they go in once they are done
+	if top.v == nil {
+		top.iface.value = orUnread(top.iface.value)
+		b.put(top.iface)
+	}
+}
+
+// put puts a value where the next one goes
+func (b *treeBuilder) put(v Value) {
+	if len(b.stack) == 0 {
+		b.root = v
+		return
+	}
+	top := b.stack[len(b.stack)-1]
+	switch c := top.v.(type) {
+	case *structValue:
+		c.fields[top.field].value = v
+		top.set = true
+	case *sliceValue:
+		c.values = append(c.values, v)
+	case *arrayValue:
+		if top.next < len(c.values) {
+			c.values[top.next] = v
+		}
+		top.next++
+	case *mapValue:
+		if !top.entry {
+			// the Handler didn't get a MapEntry for it
+			return
+		}
+		if top.key == nil {
+			top.key = v
+			return
+		}
+		c.values = append(c.values, mapEntry{key: top.key, elem: v})
+		top.entry = false
+		top.key = nil
+	case nil:
+		top.iface.value = v
+	}
+}
+
+// finish closes everything that was still being read when there was an
+// error. What was never read is marked Unread: the value that had the
+// error and, rather than as many as the length claimed, one more for the
+// rest of a slice or map.
+func (b *treeBuilder) finish() {
+	for i := len(b.stack) - 1; i >= 0; i-- {
+		top := b.stack[i]
+		switch c := top.v.(type) {
+		case *structValue:
+			if top.field >= 0 && !top.set {
+				c.fields[top.field].value = _unread_value{}
+			}
+			// the fields after the one being read were never reached
+			for j := top.field + 1; j < len(c.fields); j++ {
+				c.fields[j].value = _unread_value{}
+			}
+		case *sliceValue:
+			if !top.child {
+				c.values = append(c.values, _unread_value{})
+			}
+			if len(c.values) < top.n {
+				c.values = append(c.values, _unread_value{})
+			}
+		case *arrayValue:
+			for j := top.next; j < len(c.values); j++ {
+				c.values[j] = _unread_value{}
+			}
+		case *mapValue:
+			if top.entry {
+				c.values = append(c.values, mapEntry{key: orUnread(top.key), elem: _unread_value{}})
+			}
+			if len(c.values) < top.n {
+				c.values = append(c.values, mapEntry{key: _unread_value{}, elem: _unread_value{}})
+			}
+		case nil:
+			top.iface.value = orUnread(top.iface.value)
+		}
+		b.stack = b.stack[:i]
+		if top.v == nil {
+			b.put(top.iface)
+		}
+		if i > 0 {
+			b.stack[i-1].child = true
+		}
+	}
+	b.root = orUnread(b.root)
+}
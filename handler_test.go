@@ -0,0 +1,126 @@
+package degob
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordHandler writes down every event and skips the fields in skip
+type recordHandler struct {
+	BaseHandler
+	events []string
+	skip   string
+}
+
+func (h *recordHandler) add(format string, args ...interface{}) {
+	h.events = append(h.events, fmt.Sprintf(format, args...))
+}
+
+func (h *recordHandler) MessageStart(id TypeID) { h.add("message") }
+func (h *recordHandler) MessageEnd()            { h.add("message end") }
+func (h *recordHandler) StructStart(w *WireType) bool {
+	h.add("struct %s", w.StructT.CommonType.Name)
+	return true
+}
+func (h *recordHandler) StructFieldStart(name string, id TypeID) bool {
+	h.add("field %s", name)
+	return name != h.skip
+}
+func (h *recordHandler) SliceStart(w *WireType, n int) bool {
+	h.add("slice %d", n)
+	return true
+}
+func (h *recordHandler) ArrayStart(w *WireType, n int) bool {
+	h.add("array %d", n)
+	return true
+}
+func (h *recordHandler) MapStart(w *WireType, n int) bool {
+	h.add("map %d", n)
+	return true
+}
+func (h *recordHandler) MapEntry(i int) bool {
+	h.add("entry %d", i)
+	return true
+}
+func (h *recordHandler) InterfaceStart(name string) bool {
+	h.add("interface %s", name)
+	return true
+}
+func (h *recordHandler) Scalar(v Value) { h.add("%s", v.Display(SingleLine)) }
+func (h *recordHandler) End()           { h.add("end") }
+
+func TestDecodeHandler(t *testing.T) {
+	type Inner struct {
+		A int
+		B []string
+	}
+	type Outer struct {
+		Name string
+		In   Inner
+		M    map[string]interface{}
+	}
+	data := encodeTest(t, Outer{
+		Name: "x",
+		In:   Inner{A: 1, B: []string{"a", "b"}},
+		M:    map[string]interface{}{"k": 2},
+	})
+	all := []string{
+		"message",
+		"struct Outer",
+		"field Name", `"x"`,
+		"field In", "struct Inner",
+		"field A", "1",
+		"field B", "slice 2", `"a"`, `"b"`, "end",
+		"end",
+		"field M", "map 1", "entry 0", `"k"`, "interface int", "2", "end", "end",
+		"end",
+		"message end",
+	}
+	tests := []struct {
+		skip     string
+		expected []string
+	}{
+		{"", all},
+		// the fields are still read but nothing in them is sent
+		{"In", append(append([]string{}, all[:5]...), all[14:]...)},
+		{"B", append(append([]string{}, all[:9]...), all[13:]...)},
+	}
+	for _, tt := range tests {
+		h := &recordHandler{skip: tt.skip}
+		if err := NewDecoder(bytes.NewReader(data)).DecodeHandler(h); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(h.events, "\n")
+		expected := strings.Join(tt.expected, "\n")
+		if got != expected {
+			t.Fatalf("skipping %q expected\n%s\ngot\n%s", tt.skip, expected, got)
+		}
+	}
+}
+
+func TestDecodeHandlerExamples(t *testing.T) {
+	for _, obj := range testObjects {
+		var buf bytes.Buffer
+		fileToBufferTest(obj.fileName, &buf, t)
+		h := new(recordHandler)
+		if err := NewDecoder(&buf).DecodeHandler(h); err != nil {
+			t.Fatalf("err: %v decoding gob in file: %s", err, obj.fileName)
+		}
+		// every Start has an End
+		depth := 0
+		for _, e := range h.events {
+			switch {
+			case strings.HasPrefix(e, "struct "), strings.HasPrefix(e, "slice "),
+				strings.HasPrefix(e, "array "), strings.HasPrefix(e, "map "), strings.HasPrefix(e, "interface "):
+				depth++
+			case e == "end":
+				depth--
+			}
+		}
+		if depth != 0 {
+			t.Fatalf("unbalanced events for %s: %v", obj.fileName, h.events)
+		}
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"math"
 )
 
-type typeId int32
-
 // reads a uint from the reader
 func readUint(r io.Reader, into []byte, read *uint64) (uint64, int, *Error) {
 	var n int
@@ -83,3 +81,37 @@ func uintToFloat(x uint64) float64 {
 func uintToComplex(r uint64, i uint64) complex128 {
 	return complex(uintToFloat(r), uintToFloat(i))
 }
+
+// appends x to b in the gob uint encoding
+func appendUint(b []byte, x uint64) []byte {
+	if x <= 0x7f {
+		return append(b, uint8(x))
+	}
+	var tmp [uintByteSize]byte
+	n := uintByteSize
+	for x > 0 {
+		n--
+		tmp[n] = uint8(x)
+		x >>= 8
+	}
+	b = append(b, uint8(-(uintByteSize - n)))
+	return append(b, tmp[n:]...)
+}
+
+func intToUint(i int64) uint64 {
+	if i < 0 {
+		return uint64(^i<<1) | 1
+	}
+	return uint64(i << 1)
+}
+
+func floatToUint(f float64) uint64 {
+	u := math.Float64bits(f)
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v <<= 8
+		v |= u & 0xFF
+		u >>= 8
+	}
+	return v
+}
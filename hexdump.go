@@ -0,0 +1,143 @@
+package degob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Span is a range of a Gob's Raw bytes and what was decoded from them
+type Span struct {
+	// Offset is where the bytes start in Raw
+	Offset int
+	Len    int
+	// Label is what the bytes are, like "msg len 31" or "int -10"
+	Label string
+	// Depth is how deeply nested in types and values the bytes are
+	Depth int
+}
+
+// the fields of encoding/gob's wireType and the types they hold
+var (
+	wireTypeFields = [...]string{"ArrayT", "SliceT", "StructT", "MapT", "GobEncoderT", "BinaryMarshalerT", "TextMarshalerT"}
+	wireTypeTypes  = [...]string{"arrayType", "sliceType", "structType", "mapType", "gobEncoderType", "gobEncoderType", "gobEncoderType"}
+)
+
+// WithSpans makes the Decoder keep the bytes of every Gob along with what
+// each range of them meant, which WriteHexdump uses. It costs a copy of the
+// input so it is off by default.
+func WithSpans() Option {
+	return func(dec *Decoder) {
+		dec.recordSpans = true
+	}
+}
+
+// RecordSpans turns WithSpans on or off for everything decoded after it is
+// called
+func (dec *Decoder) RecordSpans(record bool) {
+	dec.recordSpans = record
+}
+
+// pos is the position of gobBuf in the raw bytes of the current gob
+func (dec *Decoder) pos() int {
+	return dec.msgStart + dec.gobBuf.pos
+}
+
+// label records a span for the last uint that was read
+func (dec *Decoder) label(format string, v ...interface{}) {
+	dec.spanFrom(dec.last, format, v...)
+}
+
+// spanFrom records a span from start to the current position
+func (dec *Decoder) spanFrom(start int, format string, v ...interface{}) {
+	if (!dec.recordSpans && dec.trace == nil) || dec.err != nil {
+		return
+	}
+	s := Span{
+		Offset: start,
+		Len:    dec.pos() - start,
+		Label:  fmt.Sprintf(format, v...),
+		Depth:  len(dec.frames),
+	}
+	if dec.recordSpans {
+		dec.spans = append(dec.spans, s)
+	}
+	if dec.trace != nil {
+		dec.writeTrace(s)
+	}
+}
+
+// quoteShort quotes s, cutting it off if it is too long to be a label
+func quoteShort(s string) string {
+	const max = 32
+	if len(s) <= max {
+		return strconv.Quote(s)
+	}
+	return strconv.Quote(s[:max]) + "..."
+}
+
+const hexdumpWidth = 16
+
+// WriteHexdump writes the Gob's bytes with what each range of them means,
+// like:
+//
+//	00000000  1f                 msg len 31
+//	00000001  ff 81              type id -65 def
+//	00000003  03                   field delta +3 → wireType.StructT
+//
+// Offsets are from the start of the stream. Bytes that weren't recorded as
+// part of anything are labelled as unknown, which usually points at a bug.
+// The Decoder must have been made WithSpans.
+func (g *Gob) WriteHexdump(w io.Writer) error {
+	if g.Raw == nil {
+		return errors.New("gob has no recorded bytes")
+	}
+	spans := make([]Span, len(g.Spans))
+	copy(spans, g.Spans)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Offset < spans[j].Offset })
+	pos := 0
+	for _, s := range spans {
+		if s.Offset > pos {
+			if err := g.writeHexdumpLines(w, Span{Offset: pos, Len: s.Offset - pos, Label: "unknown"}); err != nil {
+				return err
+			}
+		}
+		if err := g.writeHexdumpLines(w, s); err != nil {
+			return err
+		}
+		if end := s.Offset + s.Len; end > pos {
+			pos = end
+		}
+	}
+	if pos < len(g.Raw) {
+		return g.writeHexdumpLines(w, Span{Offset: pos, Len: len(g.Raw) - pos, Label: "unknown"})
+	}
+	return nil
+}
+
+// writeHexdumpLines writes the span's bytes, hexdumpWidth to a line, with its
+// label on the first line
+func (g *Gob) writeHexdumpLines(w io.Writer, s Span) error {
+	b := g.Raw[s.Offset : s.Offset+s.Len]
+	label := strings.Repeat("  ", s.Depth) + s.Label
+	for i := 0; i == 0 || i < len(b); i += hexdumpWidth {
+		line := b[i:]
+		if len(line) > hexdumpWidth {
+			line = line[:hexdumpWidth]
+		}
+		hex := make([]string, len(line))
+		for j, c := range line {
+			hex[j] = fmt.Sprintf("%02x", c)
+		}
+		l := fmt.Sprintf("%08x  %-*s  %s",
+			g.Offset+int64(s.Offset+i), hexdumpWidth*3-1, strings.Join(hex, " "), label)
+		if _, err := io.WriteString(w, strings.TrimRight(l, " ")+"\n"); err != nil {
+			return err
+		}
+		label = ""
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package degob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHexdump(t *testing.T) {
+	var buf bytes.Buffer
+	fileToBufferTest("nestedstructfull.bin", &buf, t)
+	gobs, err := NewDecoder(&buf, WithSpans()).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := gobs[0].WriteHexdump(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"00000000  2b",
+		"msg len 43\n",
+		"ff 81                                            type id -65 def\n",
+		"field delta +3 → wireType.StructT\n",
+		"0000006f  01                                                 field delta +1 → Test.X\n",
+		"00000070  13                                                   int -10\n",
+		"string \"Hello\"\n",
+		"complex (5+3i)\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, out.String())
+		}
+	}
+
+	if err := decodeFileTest("nestedstructfull.bin", t)[0].WriteHexdump(&out); err == nil {
+		t.Error("expected an error without recorded spans")
+	}
+}
+
+// every byte of every example should be accounted for exactly once
+func TestHexdumpSpans(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("test_examples", "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.RecordSpans(true)
+		gobs, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		var raw []byte
+		for _, g := range gobs {
+			if g.Offset != int64(len(raw)) {
+				t.Errorf("%s: gob starts at %d but the last one ended at %d", f, g.Offset, len(raw))
+			}
+			raw = append(raw, g.Raw...)
+			pos := 0
+			for _, s := range g.Spans {
+				if s.Offset != pos {
+					t.Errorf("%s: span %q starts at %d but expected %d", f, s.Label, s.Offset, pos)
+				}
+				pos = s.Offset + s.Len
+			}
+			if pos != len(g.Raw) {
+				t.Errorf("%s: spans end at %d but the gob is %d bytes", f, pos, len(g.Raw))
+			}
+		}
+		if !bytes.Equal(raw, data) {
+			t.Errorf("%s: the raw bytes of the gobs aren't the input", f)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package degob
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hints are what has been worked out about the types in gobs that the
+// gobs don't say, so that it only has to be worked out once. A Decoder made
+// WithHints applies them to the types as they are defined, which carries
+// through to WriteTypes, every Display style and WriteSource.
+type Hints struct {
+	// Names renames types by the names the Decoder would give them,
+	// including the ones it makes up for anonymous structs
+	Names map[string]string
+	// IDs renames types by their type IDs, which are only the same for
+	// captures from the same program
+	IDs map[TypeID]string
+	// Fingerprints renames types by their Fingerprints, which stay the
+	// same whatever they're called
+	Fingerprints map[string]string
+	// Fields are keyed by the name of the struct, after it has been
+	// renamed, and the name of the field, like Order.Qty
+	Fields map[string]FieldHint
+}
+
+// FieldHint renames a struct field or gives it a narrower type, or both.
+// The type has to be one that can hold what the gob has: int, int8,
+// int16 or int32 for an int64, uint, uint8, byte, uint16, uint32 or
+// uintptr for a uint64, float32 for a float64, complex64 for a complex128
+// or json.RawMessage for a []byte. Other types are ignored.
+//
+// A renamed field isn't what encoding/gob sends anymore, so the types
+// from WriteSource won't decode it into that field. Gobs written by an
+// Encoder still use the original name.
+type FieldHint struct {
+	Name string
+	Type string
+}
+
+// WithHints makes the Decoder apply h to the types it reads. A renamed
+// anonymous struct isn't named after its context anymore.
+func WithHints(h *Hints) Option {
+	return func(dec *Decoder) {
+		dec.hints = h
+	}
+}
+
+// ReadHints reads Hints from r, which has one hint per line. Empty lines
+// and lines starting with # are skipped. A type is renamed by a line with
+// the name the Decoder would give it, id:<type ID> or fp:<Fingerprint>
+// and then its new name:
+//
+//	Anon74 Price
+//	id:75 Order
+//	fp:1c9a04e2 Item
+//
+// A field is renamed or given a narrower type by a line with the struct's
+// name and the field's, then the new name, type and the type, or both:
+//
+//	Order.Qty Quantity
+//	Order.Qty type int32
+//	Order.Data Payload type json.RawMessage
+//
+// A file from ReadRenames is also a hints file.
+func ReadHints(r io.Reader) (*Hints, error) {
+	h := &Hints{
+		Names:        make(map[string]string),
+		IDs:          make(map[TypeID]string),
+		Fingerprints: make(map[string]string),
+		Fields:       make(map[string]FieldHint),
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := h.parse(strings.Fields(text)); err != nil {
+			return nil, fmt.Errorf("line %d: %v in %q", line, err, text)
+		}
+	}
+	return h, scanner.Err()
+}
+
+func (h *Hints) parse(words []string) error {
+	if len(words) < 2 {
+		return fmt.Errorf("expected a type or field and what it should be")
+	}
+	what, rest := words[0], words[1:]
+	if strings.Contains(what, ".") {
+		var f FieldHint
+		if rest[0] != "type" {
+			f.Name, rest = rest[0], rest[1:]
+			if !token.IsIdentifier(f.Name) {
+				return fmt.Errorf("bad field name %q", f.Name)
+			}
+		}
+		switch {
+		case len(rest) == 2 && rest[0] == "type":
+			f.Type = rest[1]
+		case len(rest) != 0:
+			return fmt.Errorf("expected type and a type after the field")
+		}
+		// a hint for the name and one for the type can be on two lines
+		old := h.Fields[what]
+		if f.Name == "" {
+			f.Name = old.Name
+		}
+		if f.Type == "" {
+			f.Type = old.Type
+		}
+		h.Fields[what] = f
+		return nil
+	}
+	if len(rest) != 1 || !token.IsIdentifier(rest[0]) {
+		return fmt.Errorf("expected a type and its new name")
+	}
+	switch {
+	case strings.HasPrefix(what, "id:"):
+		id, err := strconv.Atoi(what[3:])
+		if err != nil || id <= 0 {
+			return fmt.Errorf("bad type ID %q", what[3:])
+		}
+		h.IDs[TypeID(id)] = rest[0]
+	case strings.HasPrefix(what, "fp:"):
+		h.Fingerprints[what[3:]] = rest[0]
+	default:
+		h.Names[what] = rest[0]
+	}
+	return nil
+}
+
+// Fingerprint is a hash of what w looks like: what kind of type it is, the
+// types it holds and, for a struct, the names of its fields. The names of
+// the types aren't part of it so the same type gets the same Fingerprint
+// whatever it is called, whatever its ID is and whichever encoder sent it.
+func (w *WireType) Fingerprint() string {
+	return fmt.Sprintf("%08x", w.shape(make(map[*WireType]uint32)))
+}
+
+func (w *WireType) shape(memo map[*WireType]uint32) uint32 {
+	if s, ok := memo[w]; ok {
+		return s
+	}
+	// where a type holds itself
+	memo[w] = 0
+	h := fnv.New32a()
+	elem := func(id TypeID) {
+		switch t := w.resolve(id); {
+		case id.IsBuiltin():
+			fmt.Fprintf(h, " %d", id)
+		case t == nil:
+			h.Write([]byte(" ?"))
+		default:
+			fmt.Fprintf(h, " %08x", t.shape(memo))
+		}
+	}
+	switch {
+	case w.StructT != nil:
+		h.Write([]byte("struct"))
+		for _, f := range w.StructT.Field {
+			fmt.Fprintf(h, " %s", f.wire())
+			elem(f.Id)
+		}
+	case w.SliceT != nil:
+		h.Write([]byte("slice"))
+		elem(w.SliceT.Elem)
+	case w.ArrayT != nil:
+		fmt.Fprintf(h, "array %d", w.ArrayT.Len)
+		elem(w.ArrayT.Elem)
+	case w.MapT != nil:
+		h.Write([]byte("map"))
+		elem(w.MapT.Key)
+		elem(w.MapT.Elem)
+	default:
+		// what opaque types hold is only known from their names
+		if c := w.Common(); c != nil {
+			fmt.Fprintf(h, "opaque %s", c.Name)
+		}
+	}
+	memo[w] = h.Sum32()
+	return memo[w]
+}
+
+// hintedName returns what the hints rename name to
+func (dec *Decoder) hintedName(name string) (string, bool) {
+	if dec.hints == nil {
+		return "", false
+	}
+	n, ok := dec.hints.Names[name]
+	return n, ok
+}
+
+// hintName renames id by its name or ID
+func (dec *Decoder) hintName(id TypeID, w *WireType) {
+	c := w.Common()
+	if c == nil || dec.fixedNames[id] || dec.hints == nil {
+		return
+	}
+	name, ok := dec.hints.IDs[id]
+	if !ok {
+		name, ok = dec.hints.Names[c.Name]
+	}
+	if ok {
+		c.Name = name
+		dec.fixHintedName(id)
+	}
+}
+
+// fixHintedName fixes the name hints gave id so nothing else renames it
+func (dec *Decoder) fixHintedName(id TypeID) {
+	dec.fixName(id)
+	if dec.hintedNames == nil {
+		dec.hintedNames = make(map[TypeID]bool)
+	}
+	dec.hintedNames[id] = true
+}
+
+// resolveTypes does what can only be done once the types that the types
+// defined since the last time refer to are too, which is before a value is
+// read: names from Fingerprints, for hints and HashNames, matching the
+// Schema and field hints.
+func (dec *Decoder) resolveTypes() {
+	if len(dec.pending) == 0 {
+		return
+	}
+	// types from WithTypes are in no particular order
+	sort.Slice(dec.pending, func(i, j int) bool { return dec.pending[i] < dec.pending[j] })
+	memo := make(map[*WireType]uint32)
+	for _, id := range dec.pending {
+		w, ok := dec.seenTypes[id]
+		if !ok {
+			continue
+		}
+		dec.hintName(id, w)
+		c := w.Common()
+		// a Fingerprint is a better guess than where a type is used
+		if c != nil && !dec.hintedNames[id] && (dec.names == HashNames || dec.hints != nil) {
+			fp := fmt.Sprintf("%08x", w.shape(memo))
+			if name, ok := dec.hints.fingerprint(fp); ok {
+				c.Name = name
+				dec.fixHintedName(id)
+			} else if dec.names == HashNames && w.StructT != nil && (w.StructT.anonymous || !token.IsIdentifier(c.Name)) {
+				// encoding/gob names the rest by their Go types
+				c.Name = "Anon_" + fp
+			}
+		}
+		if w.StructT != nil && dec.schema != nil {
+			dec.matchSchema(id, w)
+		}
+	}
+	// fields can refer to any of the types
+	for _, id := range dec.pending {
+		w, ok := dec.seenTypes[id]
+		if !ok || w.StructT == nil {
+			continue
+		}
+		if ss, ok := dec.schemaTypes[id]; ok {
+			dec.schemaFields(w, ss)
+		}
+		if dec.hints != nil {
+			dec.hintFields(w)
+		}
+	}
+	dec.pending = dec.pending[:0]
+}
+
+func (h *Hints) fingerprint(fp string) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	name, ok := h.Fingerprints[fp]
+	return name, ok
+}
+
+// hintFields renames the fields of w and gives them narrower types
+func (dec *Decoder) hintFields(w *WireType) {
+	for _, f := range w.StructT.Field {
+		wire := f.wire()
+		hint, ok := dec.hints.Fields[w.StructT.Name+"."+wire]
+		if !ok {
+			continue
+		}
+		if hint.Name != "" {
+			f.wireName = wire
+			f.Name = hint.Name
+		}
+		if hint.Type != "" && narrowerType(f.Id, hint.Type) {
+			f.hint = &goType{expr: hint.Type}
+			if hint.Type == "json.RawMessage" {
+				f.hint.imports = []string{`"encoding/json"`}
+			}
+			f.TypeString = hint.Type
+		}
+	}
+}
+
+// wire is the name the field is sent with
+func (f *FieldType) wire() string {
+	if f.wireName != "" {
+		return f.wireName
+	}
+	return f.Name
+}
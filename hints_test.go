@@ -0,0 +1,143 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+type hintOrder struct {
+	Qty   int
+	Count uint
+	Data  []byte
+	Price struct{ Cents int }
+}
+
+func TestReadHints(t *testing.T) {
+	h, err := ReadHints(strings.NewReader(`# comment
+
+Anon74 Price
+id:75 Order
+fp:1c9a04e2 Item
+Order.Qty Quantity
+Order.Qty type int32
+Order.Data Payload type json.RawMessage
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Names["Anon74"] != "Price" || h.IDs[75] != "Order" || h.Fingerprints["1c9a04e2"] != "Item" {
+		t.Fatal("unexpected type hints", h.Names, h.IDs, h.Fingerprints)
+	}
+	if f := h.Fields["Order.Qty"]; f != (FieldHint{Name: "Quantity", Type: "int32"}) {
+		t.Fatal("expected the two Qty lines to be merged got", f)
+	}
+	if f := h.Fields["Order.Data"]; f != (FieldHint{Name: "Payload", Type: "json.RawMessage"}) {
+		t.Fatal("unexpected Data hint", f)
+	}
+	for _, bad := range []string{"Order", "Order Or der", "id:x Order", "id:0 Order", "Order 9", "Order.Qty 9", "Order.Qty type", "Order.Qty Quantity int32"} {
+		if _, err := ReadHints(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHints(t *testing.T) {
+	v := hintOrder{Qty: 2, Count: 3, Data: []byte(`{"a": [1, 2]}`)}
+	v.Price.Cents = 150
+	b := encodeTest(t, v)
+	decode := func(h *Hints) *Gob {
+		gobs, err := NewDecoder(bytes.NewReader(b), WithHints(h)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gobs[0]
+	}
+
+	// the same types have the same Fingerprints whatever they're called
+	g := decode(&Hints{Names: map[string]string{"hintOrder": "Order"}})
+	var price *WireType
+	for _, w := range g.Types {
+		if w.StructT != nil && w.StructT.Name != "Order" {
+			price = w
+		}
+	}
+	fp := price.Fingerprint()
+	if again := decode(nil).Types[price.Id()].Fingerprint(); again != fp {
+		t.Fatalf("expected the fingerprint %s got %s", fp, again)
+	}
+
+	h, err := ReadHints(strings.NewReader(`hintOrder Order
+fp:` + fp + ` Price
+Order.Qty Quantity type int32
+Order.Count type byte
+Order.Data type json.RawMessage
+Order.Price type int8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g = decode(h)
+	// and rename structs that were named after where they were used
+	h.Fingerprints[fp] = "Cost"
+	gobs, err := NewDecoder(bytes.NewReader(b), WithHints(h), WithNaming(ContextNames)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := gobs[0].Types[price.Id()].StructT.Name; name != "Cost" {
+		t.Fatal("expected the fingerprint hint to win got", name)
+	}
+	h.Fingerprints[fp] = "Price"
+
+	var types bytes.Buffer
+	if err := g.WriteTypes(&types); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"type Order struct", "\tQuantity int32\n", "\tCount byte\n", "\tData json.RawMessage\n", "type Price struct", "\tPrice Price\n"} {
+		if !strings.Contains(types.String(), s) {
+			t.Errorf("expected the types to have %q got\n%s", s, types.String())
+		}
+	}
+
+	expected := "Order{Quantity: 2, Count: 3, Data: json.RawMessage(`{\"a\": [1, 2]}`), Price: Price{Cents: 150}}"
+	if out := g.Value.Display(SingleLine); out != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+	expected = `{"Quantity": 2, "Count": 3, "Data": {"a":[1,2]}, "Price": {"Cents": 150}}`
+	if out := g.Value.Display(JSON); out != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	var src bytes.Buffer
+	if err := WriteSource(&src, "models", g); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := format.Source(src.Bytes()); err != nil {
+		t.Fatal(err, src.String())
+	}
+	if !strings.Contains(src.String(), "import \"encoding/json\"") || !strings.Contains(src.String(), "Quantity int32") {
+		t.Errorf("expected the source to use the hints got\n%s", src.String())
+	}
+
+	// renamed fields are still sent with their names
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(g); err != nil {
+		t.Fatal(err)
+	}
+	var got hintOrder
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Qty != v.Qty || string(got.Data) != string(v.Data) || got.Price != v.Price {
+		t.Fatalf("expected %+v got %+v", v, got)
+	}
+	res, err := verifyGobs(b, []*Gob{g}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Mismatches) != 0 {
+		t.Fatal("unexpected mismatches", res.Mismatches)
+	}
+}
@@ -0,0 +1,200 @@
+package degob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Message is where one message is in the input to an Index
+type Message struct {
+	Offset int64  // where its length starts
+	Len    int64  // how many bytes it is, length included
+	Def    bool   // whether it defines a type or has a value
+	TypeID TypeID // the type it defines or the type of its value
+	// Session counts the encoders that wrote the input. Type IDs only
+	// mean anything within one, so it starts over whenever a type is
+	// defined again, along with the definitions after the last value
+	// that came before that one. Definitions inside values aren't seen
+	// by the Index so a session can also start earlier than this says.
+	Session int
+}
+
+// Index lists the messages in a file of gobs without decoding them, so
+// one gob can be picked out of a file too big to decode all of, either by
+// its position or by its type.
+//
+// A value with an interface holding a type that hadn't been sent yet goes
+// on into the messages after it, since encoding/gob sends the definition
+// in the middle of the value. Those look like values of whatever type
+// their first bytes happen to be and can't be decoded on their own, only
+// as part of the message the value started in.
+type Index struct {
+	Messages []Message
+	r        io.ReaderAt
+	opts     []Option
+}
+
+// NewIndex reads the length and type ID at the start of every message in
+// r and nothing else. If the input ends in the middle of a message the
+// Index has the ones before it along with an *Error wrapping
+// io.ErrUnexpectedEOF. opts are given to the Decoders used by Decode.
+func NewIndex(r io.ReaderAt, opts ...Option) (*Index, error) {
+	ix := &Index{r: r, opts: opts}
+	defined := make(map[TypeID]bool)
+	// the definitions since the last value, which go with the value
+	var defs []int
+	session := 0
+	var off int64
+	var b [9]byte
+	for {
+		if _, err := r.ReadAt(b[:1], off); err == io.EOF {
+			return ix, nil
+		}
+		var read uint64
+		size, width, err := readUint(io.NewSectionReader(r, off, 9), b[:], &read)
+		if err != nil {
+			return ix, ix.indexError(err, off)
+		}
+		if size == 0 || size > math.MaxInt64-uint64(off)-uint64(width) {
+			return ix, ix.indexError(genericError(errors.New("bad message length"), 0, nil), off)
+		}
+		end := off + int64(width) + int64(size)
+		// the last byte being there means all of it is
+		if _, err := r.ReadAt(b[:1], end-1); err != nil {
+			return ix, ix.indexError(genericError(io.ErrUnexpectedEOF, 0, nil), off)
+		}
+		n, _, err := readUint(io.NewSectionReader(r, off+int64(width), int64(size)), b[:], &read)
+		if err != nil {
+			return ix, ix.indexError(err, off)
+		}
+		m := Message{Offset: off, Len: end - off, TypeID: TypeID(uintToInt(n))}
+		if m.TypeID < 0 {
+			m.Def = true
+			m.TypeID = -m.TypeID
+			if defined[m.TypeID] {
+				session++
+				defined = make(map[TypeID]bool)
+				for _, i := range defs {
+					ix.Messages[i].Session = session
+					defined[ix.Messages[i].TypeID] = true
+				}
+			}
+			defined[m.TypeID] = true
+			defs = append(defs, len(ix.Messages))
+		} else {
+			defs = defs[:0]
+		}
+		m.Session = session
+		ix.Messages = append(ix.Messages, m)
+		off = end
+	}
+}
+
+func (ix *Index) indexError(err *Error, off int64) *Error {
+	err.Processed = uint64(off)
+	err.Message = len(ix.Messages)
+	return err
+}
+
+// SetOptions sets the limits of the Decoders used by Decode
+func (ix *Index) SetOptions(opts DecoderOptions) {
+	ix.opts = append(ix.opts, WithLimits(opts))
+}
+
+// Values returns the positions of the messages with values of type id
+func (ix *Index) Values(id TypeID) []int {
+	var found []int
+	for i, m := range ix.Messages {
+		if !m.Def && m.TypeID == id {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// Decode decodes the gob whose value starts in message n. Only the type
+// definitions before it in its session are read along with it, unless
+// they aren't enough because it uses a type that was defined inside an
+// earlier value. Then the session is read from the start up to it, only
+// building the Value for that one gob. Message in an *Error is counted
+// from the start of the Index like n.
+func (ix *Index) Decode(n int) (*Gob, error) {
+	if n < 0 || n >= len(ix.Messages) {
+		return nil, fmt.Errorf("there is no message %d", n)
+	}
+	m := ix.Messages[n]
+	if m.Def {
+		return nil, fmt.Errorf("message %d is a type definition", n)
+	}
+	first := n
+	for first > 0 && ix.Messages[first-1].Session == m.Session {
+		first--
+	}
+	var readers []io.Reader
+	for _, d := range ix.Messages[first:n] {
+		if d.Def {
+			readers = append(readers, io.NewSectionReader(ix.r, d.Offset, d.Len))
+		}
+	}
+	defs := len(readers)
+	readers = append(readers, ix.section(m.Offset))
+	dec := ix.decoder(io.MultiReader(readers...))
+	g, err := dec.nextGob(nil)
+	if err == nil || !(errors.Is(err, errUnknownType) || errors.Is(err, errUnexpectedType)) {
+		return ix.gob(g, err, n-defs)
+	}
+
+	dec = ix.decoder(ix.section(ix.Messages[first].Offset))
+	dec.h = skipHandler{}
+	for first+dec.messages < n {
+		dec.getGobPiece()
+		dec.decodeGobPiece()
+		if dec.err != nil {
+			dec.locateErr()
+			return ix.gob(nil, dec.err, first)
+		}
+		if dec.inValue {
+			dec.clearGob()
+		}
+	}
+	if first+dec.messages > n {
+		return nil, fmt.Errorf("message %d is the rest of a value that starts before it", n)
+	}
+	dec.h = dec.tree
+	g, err = dec.nextGob(nil)
+	return ix.gob(g, err, first)
+}
+
+func (ix *Index) section(off int64) io.Reader {
+	return io.NewSectionReader(ix.r, off, math.MaxInt64-off)
+}
+
+func (ix *Index) decoder(r io.Reader) *Decoder {
+	return NewDecoder(r, ix.opts...)
+}
+
+// gob returns what nextGob did with the message in an error counted from
+// the start of the Index. The decoder started at message first.
+func (ix *Index) gob(g *Gob, err *Error, first int) (*Gob, error) {
+	if err != nil {
+		err.Message += first
+		return nil, err
+	}
+	if g == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return g, nil
+}
+
+// skipHandler doesn't want any of the values
+type skipHandler struct {
+	BaseHandler
+}
+
+func (skipHandler) StructStart(*WireType) bool     { return false }
+func (skipHandler) SliceStart(*WireType, int) bool { return false }
+func (skipHandler) ArrayStart(*WireType, int) bool { return false }
+func (skipHandler) MapStart(*WireType, int) bool   { return false }
+func (skipHandler) InterfaceStart(string) bool     { return false }
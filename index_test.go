@@ -0,0 +1,204 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type indexOuter struct {
+	X int
+	I interface{}
+}
+
+type indexInner struct {
+	S string
+}
+
+func TestIndex(t *testing.T) {
+	gob.Register(indexInner{})
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []interface{}{
+		indexOuter{X: 1},
+		// indexInner is defined in the middle of this one
+		indexOuter{X: 2, I: indexInner{"a"}},
+		indexOuter{X: 3, I: indexInner{"b"}},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// and a second encoder
+	if err := gob.NewEncoder(&buf).Encode(indexInner{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	expected, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := NewIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var off int64
+	var defs []bool
+	for _, m := range ix.Messages {
+		if m.Offset != off {
+			t.Fatalf("expected a message at %d got %+v", off, m)
+		}
+		off += m.Len
+		defs = append(defs, m.Def)
+	}
+	if off != int64(len(b)) {
+		t.Fatalf("indexed %d of %d bytes", off, len(b))
+	}
+	if !equalBools(defs, []bool{true, false, false, false, false, true, false}) {
+		t.Fatal("unexpected messages", ix.Messages)
+	}
+
+	var got []*Gob
+	for _, n := range []int{1, 2, 4, 6} {
+		g, err := ix.Decode(n)
+		if err != nil {
+			t.Fatalf("message %d: %v", n, err)
+		}
+		got = append(got, g)
+	}
+	compareDisplay(t, expected, got)
+	for _, n := range []int{0, 3, 7} {
+		if _, err := ix.Decode(n); err == nil {
+			t.Fatalf("expected an error decoding message %d", n)
+		}
+	}
+	outer := ix.Messages[1].TypeID
+	if vals := ix.Values(outer); len(vals) != 3 || vals[0] != 1 || vals[1] != 2 || vals[2] != 4 {
+		t.Fatalf("expected values 1, 2 and 4 of %d got %v", outer, vals)
+	}
+
+	ix, err = NewIndex(bytes.NewReader(b[:len(b)-3]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("expected unexpected EOF got", err)
+	}
+	if len(ix.Messages) != 6 {
+		t.Fatalf("expected the 6 whole messages got %d", len(ix.Messages))
+	}
+}
+
+func TestIndexReusedTypes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sessionInner{1}); err != nil {
+		t.Fatal(err)
+	}
+	// sessionOuter is new to the second encoder and comes before the
+	// redefined sessionInner
+	if err := gob.NewEncoder(&buf).Encode(sessionOuter{sessionInner{2}}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	expected, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*Gob
+	for n, m := range ix.Messages {
+		if m.Def {
+			continue
+		}
+		g, err := ix.Decode(n)
+		if err != nil {
+			t.Fatalf("message %d: %v", n, err)
+		}
+		got = append(got, g)
+	}
+	compareDisplay(t, expected, got)
+	if last := ix.Messages[len(ix.Messages)-1]; last.Session != 1 || ix.Messages[2].Session != 1 {
+		t.Fatal("expected the second encoder's definitions in session 1", ix.Messages)
+	}
+}
+
+type indexNamed struct {
+	Home struct{ Street string }
+}
+
+func TestIndexOptions(t *testing.T) {
+	b := encodeTest(t, indexNamed{})
+	opts := []Option{WithNaming(ContextNames)}
+	expected, err := NewDecoder(bytes.NewReader(b), opts...).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIndex(bytes.NewReader(b), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.SetOptions(DecoderOptions{MaxDepth: 50})
+	g, err := ix.Decode(len(ix.Messages) - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp(typesString(g), typesString(expected[0]), t)
+	cmp(g.Display(SingleLine), "indexNamed{Home: Home{Street: \"\"}}", t)
+
+	ix.SetOptions(DecoderOptions{MaxDepth: 1})
+	if _, err := ix.Decode(len(ix.Messages) - 1); !errors.Is(err, ErrTooDeep) {
+		t.Fatal("expected the limits to be used got", err)
+	}
+}
+
+func equalBools(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIndexExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("test_examples", "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		expected, err := NewDecoder(f).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix, err := NewIndex(f)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		// every example is one gob whose value starts in the first
+		// message that isn't a definition
+		for n, m := range ix.Messages {
+			if m.Def {
+				continue
+			}
+			g, err := ix.Decode(n)
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			compareDisplay(t, expected, []*Gob{g})
+			break
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package degob
+
+import "iter"
+
+// All returns an iterator over the Gobs from Next. Errors are yielded with
+// a nil Gob and iteration carries on after them the same way Next does.
+//
+//	for g, err := range dec.All() {
+//		...
+//	}
+func (dec *Decoder) All() iter.Seq2[*Gob, error] {
+	return func(yield func(*Gob, error) bool) {
+		for {
+			g, err := dec.nextGob(nil)
+			if g == nil && err == nil {
+				return
+			}
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+			if !yield(g, nil) {
+				return
+			}
+		}
+	}
+}
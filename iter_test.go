@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package degob
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	var buf bytes.Buffer
+	for _, obj := range testObjects[:3] {
+		fileToBufferTest(obj.fileName, &buf, t)
+	}
+	i := 0
+	for g, err := range NewDecoder(&buf).All() {
+		if err != nil {
+			t.Fatalf("err: %v decoding gob in file: %s", err, testObjects[i].fileName)
+		}
+		compareGobs(testObjects[i].expected, g, testObjects[i].fileName, t)
+		i++
+		if i == 2 {
+			break
+		}
+	}
+	if i != 2 {
+		t.Fatal("expected to stop after 2 gobs got", i)
+	}
+}
@@ -56,7 +56,7 @@ type degobTestObject struct {
 }
 
 const (
-	unpredictableId typeId = -100000
+	unpredictableId TypeID = -100000
 )
 
 var testObjects = []degobTestObject{
@@ -92,18 +92,18 @@ var testObjects = []degobTestObject{
 					structField{name: "Z", value: _string_type("Hello")},
 				},
 			},
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Test",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
-							&FieldType{Name: "W", Id: int(unpredictableId)},
-							&FieldType{Name: "X", Id: int(_int_id)},
-							&FieldType{Name: "Y", Id: int(_uint_id)},
-							&FieldType{Name: "Z", Id: int(_string_id)},
+							&FieldType{Name: "W", Id: unpredictableId},
+							&FieldType{Name: "X", Id: IntID},
+							&FieldType{Name: "Y", Id: UintID},
+							&FieldType{Name: "Z", Id: StringID},
 						},
 					},
 				},
@@ -111,12 +111,12 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Inner",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
-							&FieldType{Name: "A", Id: int(_float_id)},
-							&FieldType{Name: "B", Id: int(_complex_id)},
-							&FieldType{Name: "C", Id: int(_bytes_id)},
+							&FieldType{Name: "A", Id: FloatID},
+							&FieldType{Name: "B", Id: ComplexID},
+							&FieldType{Name: "C", Id: BytesID},
 						},
 					},
 				},
@@ -146,18 +146,18 @@ var testObjects = []degobTestObject{
 					structField{name: "Z", value: _string_type("")},
 				},
 			},
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Test",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
-							&FieldType{Name: "W", Id: int(unpredictableId)},
-							&FieldType{Name: "X", Id: int(_int_id)},
-							&FieldType{Name: "Y", Id: int(_uint_id)},
-							&FieldType{Name: "Z", Id: int(_string_id)},
+							&FieldType{Name: "W", Id: unpredictableId},
+							&FieldType{Name: "X", Id: IntID},
+							&FieldType{Name: "Y", Id: UintID},
+							&FieldType{Name: "Z", Id: StringID},
 						},
 					},
 				},
@@ -165,12 +165,12 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Inner",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
-							&FieldType{Name: "A", Id: int(_float_id)},
-							&FieldType{Name: "B", Id: int(_complex_id)},
-							&FieldType{Name: "C", Id: int(_bytes_id)},
+							&FieldType{Name: "A", Id: FloatID},
+							&FieldType{Name: "B", Id: ComplexID},
+							&FieldType{Name: "C", Id: BytesID},
 						},
 					},
 				},
@@ -192,14 +192,14 @@ var testObjects = []degobTestObject{
 					_int_type(2),
 				},
 			},
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					ArrayT: &ArrayType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
 						Len:  5,
-						Elem: _int_id,
+						Elem: IntID,
 					},
 				},
 			},
@@ -211,18 +211,18 @@ var testObjects = []degobTestObject{
 			"one", "two", "three",
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					SliceT: &SliceType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
-						Elem: _string_id,
+						Elem: StringID,
 					},
 				},
 			},
 			Value: &sliceValue{
-				elemType: _string_id.name(),
+				elemType: StringID.name(),
 				values: []Value{
 					_string_type("one"),
 					_string_type("two"),
@@ -238,20 +238,20 @@ var testObjects = []degobTestObject{
 			"negative ten point five": -10.5,
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					MapT: &MapType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
-						Key:  _string_id,
-						Elem: _float_id,
+						Key:  StringID,
+						Elem: FloatID,
 					},
 				},
 			},
 			Value: &mapValue{
-				keyType:  _string_id.name(),
-				elemType: _float_id.name(),
+				keyType:  StringID.name(),
+				elemType: FloatID.name(),
 				values: []mapEntry{
 					mapEntry{
 						key:  _string_type("one point two"),
@@ -272,11 +272,11 @@ var testObjects = []degobTestObject{
 			ArrayInner{-1.5, -10},
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					ArrayT: &ArrayType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
 						Len:  3,
 						Elem: unpredictableId,
@@ -286,18 +286,18 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Anon70",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								Name:       "Float",
 								TypeString: "float64",
-								Id:         int(_float_id),
+								Id:         FloatID,
 							},
 							&FieldType{
 								Name:       "Int",
 								TypeString: "int64",
-								Id:         int(_int_id),
+								Id:         IntID,
 							},
 						},
 					},
@@ -339,21 +339,21 @@ var testObjects = []degobTestObject{
 			SliceInner{5, 0x35},
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "SliceInner",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								Name: "Uint",
-								Id:   int(_uint_id),
+								Id:   UintID,
 							},
 							&FieldType{
 								Name: "Byte",
-								Id:   int(_uint_id),
+								Id:   UintID,
 							},
 						},
 					},
@@ -361,7 +361,7 @@ var testObjects = []degobTestObject{
 				unpredictableId - 1: &WireType{
 					SliceT: &SliceType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
 						Elem: unpredictableId,
 					},
@@ -395,11 +395,11 @@ var testObjects = []degobTestObject{
 			KeyType(10.2 + 3.5i): ElemType{2 - 3i, -10.2},
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					MapT: &MapType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
 						Key:  unpredictableId,
 						Elem: unpredictableId,
@@ -409,16 +409,16 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "Anon74",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								Name: "Complex",
-								Id:   int(_complex_id),
+								Id:   ComplexID,
 							},
 							&FieldType{
 								Name: "Float",
-								Id:   int(_float_id),
+								Id:   FloatID,
 							},
 						},
 					},
@@ -510,15 +510,15 @@ var testObjects = []degobTestObject{
 			5732:           nil,
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					MapT: &MapType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
-						Key:            _interface_id,
+						Key:            InterfaceID,
 						KeyTypeString:  "interface{}",
-						Elem:           _interface_id,
+						Elem:           InterfaceID,
 						ElemTypeString: "interface{}",
 					},
 				},
@@ -574,32 +574,32 @@ var testObjects = []degobTestObject{
 		fileName: "allpointers.bin",
 		item:     newAllPointers(),
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "AllPointers",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								TypeString: "int64",
-								Id:         int(_int_id),
+								Id:         IntID,
 								Name:       "X",
 							},
 							&FieldType{
 								TypeString: "string",
-								Id:         int(_string_id),
+								Id:         StringID,
 								Name:       "Y",
 							},
 							&FieldType{
 								TypeString: "bool",
-								Id:         int(_bool_id),
+								Id:         BoolID,
 								Name:       "Z",
 							},
 							&FieldType{
 								TypeString: "interface{}",
-								Id:         int(_interface_id),
+								Id:         InterfaceID,
 								Name:       "Q",
 							},
 						},
@@ -632,15 +632,15 @@ var testObjects = []degobTestObject{
 			ArrayInner{1.2, 1}: SliceInner{10, 0x04},
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					MapT: &MapType{
 						CommonType: CommonType{
-							Id: int(unpredictableId),
+							Id: unpredictableId,
 						},
-						Key:            _interface_id,
+						Key:            InterfaceID,
 						KeyTypeString:  "interface{}",
-						Elem:           _interface_id,
+						Elem:           InterfaceID,
 						ElemTypeString: "interface{}",
 					},
 				},
@@ -648,18 +648,18 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "ArrayInner",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								Name:       "Float",
 								TypeString: "float64",
-								Id:         int(_float_id),
+								Id:         FloatID,
 							},
 							&FieldType{
 								Name:       "Int",
 								TypeString: "float64",
-								Id:         int(_int_id),
+								Id:         IntID,
 							},
 						},
 					},
@@ -668,16 +668,16 @@ var testObjects = []degobTestObject{
 					StructT: &StructType{
 						CommonType: CommonType{
 							Name: "SliceInner",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
 						Field: []*FieldType{
 							&FieldType{
 								Name: "Uint",
-								Id:   int(_uint_id),
+								Id:   UintID,
 							},
 							&FieldType{
 								Name: "Byte",
-								Id:   int(_uint_id),
+								Id:   UintID,
 							},
 						},
 					},
@@ -750,16 +750,16 @@ var testObjects = []degobTestObject{
 			"bye": -10.4,
 		},
 		expected: &Gob{
-			Types: map[typeId]*WireType{
+			Types: map[TypeID]*WireType{
 				unpredictableId: &WireType{
 					MapT: &MapType{
 						CommonType: CommonType{
 							Name: "UserMap",
-							Id:   int(unpredictableId),
+							Id:   unpredictableId,
 						},
-						Key:            _string_id,
+						Key:            StringID,
 						KeyTypeString:  "string",
-						Elem:           _interface_id,
+						Elem:           InterfaceID,
 						ElemTypeString: "interface{}",
 					},
 				},
@@ -958,7 +958,7 @@ func compareStruct(expected *StructType, got *StructType) bool {
 			if f.Name != of.Name {
 				continue
 			}
-			if f.Id > int(unpredictableId) {
+			if f.Id > unpredictableId {
 				if f.Id != of.Id {
 					continue
 				}
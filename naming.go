@@ -0,0 +1,337 @@
+package degob
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Naming is how a Decoder names anonymous structs, which gobs don't have a
+// name for
+type Naming uint8
+
+const (
+	// IDNames calls them Anon<ID> after their type ID. It is the default.
+	// IDs are only unique within one encoder session so different structs
+	// from different sessions can end up with the same name.
+	IDNames Naming = iota
+	// RandomNames adds a random hex suffix to the ID, Anon<ID>_<hex>, which
+	// is different every run unless the Decoder is made WithNamingSeed
+	RandomNames
+	// SequentialNames numbers them in the order the Decoder names them,
+	// Anon1, Anon2 and so on, which is unique across sessions
+	SequentialNames
+	// HashNames calls them Anon_<Fingerprint>, so the same struct gets the
+	// same name whatever its ID and whichever encoder sent it
+	HashNames
+	// ContextNames names them after where they are first used: a struct
+	// in field Address is called Address and the elements of
+	// Items []struct{...} are called Item. If the name is taken the name
+	// of the struct with the field goes in front of it and then a number
+	// after it. Structs that aren't used anywhere else, like the types of
+	// whole values, are called Anon<ID>. Unnamed structs that encoding/gob
+	// called by their Go type, like struct { X int }, get names too.
+	ContextNames
+)
+
+// WithNaming sets how the Decoder names anonymous structs
+func WithNaming(n Naming) Option {
+	return func(dec *Decoder) {
+		dec.names = n
+	}
+}
+
+// WithNamingSeed makes the Decoder use RandomNames with suffixes from seed,
+// so they are the same every time the same input is decoded
+func WithNamingSeed(seed int64) Option {
+	return func(dec *Decoder) {
+		dec.names = RandomNames
+		dec.seed = seed
+		dec.seeded = true
+	}
+}
+
+// namingState is what the Decoder has named so far, which a PushDecoder
+// puts back when it decodes a gob over again
+type namingState struct {
+	seed      int64
+	seeded    bool
+	suffixes  int             // random suffixes drawn from seed so far
+	usedNames map[string]bool // random suffixes given out so far
+	anonCount int             // anonymous structs named for SequentialNames
+
+	// the rest is for the current session
+	pending     []TypeID                 // types defined since resolveTypes
+	fixedNames  map[TypeID]bool          // types named by renames or ContextNames
+	hintedNames map[TypeID]bool          // types named by hints
+	uses        map[TypeID]use           // where types are used, for ContextNames
+	takenNames  map[string]bool          // names given to types in the session
+	numbered    map[string]int           // the last number freeName gave each name
+	schemaTypes map[TypeID]*schemaStruct // structs matched to the Schema
+}
+
+func (n namingState) clone() namingState {
+	n.usedNames = copyMap(n.usedNames)
+	n.pending = append([]TypeID(nil), n.pending...)
+	n.fixedNames = copyMap(n.fixedNames)
+	n.hintedNames = copyMap(n.hintedNames)
+	n.uses = copyMap(n.uses)
+	n.takenNames = copyMap(n.takenNames)
+	n.numbered = copyMap(n.numbered)
+	n.schemaTypes = copyMap(n.schemaTypes)
+	return n
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// WithRenames renames types: the keys are the names the Decoder would
+// give them, including the names it makes up for anonymous structs, and
+// the values are what they should be called instead. It is WithHints with
+// only Names. See ReadRenames.
+func WithRenames(renames map[string]string) Option {
+	return WithHints(&Hints{Names: renames})
+}
+
+// ReadRenames reads renames for WithRenames from r, one per line as the
+// old name and the new one separated by spaces. Empty lines and lines
+// starting with # are skipped.
+func ReadRenames(r io.Reader) (map[string]string, error) {
+	renames := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		names := strings.Fields(text)
+		if len(names) != 2 || !token.IsIdentifier(names[1]) {
+			return nil, fmt.Errorf("line %d: expected an old name and a new one, got %q", line, text)
+		}
+		renames[names[0]] = names[1]
+	}
+	return renames, scanner.Err()
+}
+
+// anonymousStructTypeName names w and remembers the name on it
+func (dec *Decoder) anonymousStructTypeName(w *WireType) string {
+	id := w.StructT.Id
+	var s string
+	switch dec.names {
+	case RandomNames:
+		s = fmt.Sprintf("Anon%d_%s", id, dec.randomSuffix())
+	case SequentialNames:
+		dec.anonCount++
+		s = fmt.Sprintf("Anon%d", dec.anonCount)
+	default:
+		// ContextNames and HashNames start off like this too
+		s = fmt.Sprintf("Anon%d", id)
+	}
+	w.StructT.CommonType.Name = s
+	return s
+}
+
+// randomSuffix returns 8 hex digits that it hasn't before
+func (dec *Decoder) randomSuffix() string {
+	if !dec.seeded {
+		dec.seed = time.Now().UnixNano()
+		dec.seeded = true
+	}
+	if dec.usedNames == nil {
+		dec.usedNames = make(map[string]bool)
+	}
+	follow := make([]byte, 4)
+	for {
+		// each suffix only depends on the seed and how many came before it
+		// so the ones after a gob that is decoded again are the same
+		dec.suffixes++
+		_, _ = rand.New(rand.NewSource(dec.seed + int64(dec.suffixes))).Read(follow)
+		s := hex.EncodeToString(follow)
+		// this shouldn't happen much
+		if !dec.usedNames[s] {
+			dec.usedNames[s] = true
+			return s
+		}
+	}
+}
+
+// defined renames the type that was just defined to id and, for
+// ContextNames, names the anonymous structs it uses or is used as. A
+// gob.Encoder sends a type before the types it uses but that isn't relied
+// on. The rest is done by resolveTypes once they are all there.
+func (dec *Decoder) defined(id TypeID, w *WireType) {
+	dec.pending = append(dec.pending, id)
+	dec.hintName(id, w)
+	if c := w.Common(); c != nil {
+		dec.takeName(c.Name)
+	}
+	if dec.names != ContextNames {
+		return
+	}
+	switch {
+	case w.StructT != nil:
+		for _, f := range w.StructT.Field {
+			dec.usedAs(f.Id, use{name: f.Name, parent: w.StructT.Name})
+		}
+	case w.SliceT != nil && token.IsIdentifier(w.SliceT.Name):
+		dec.usedAs(w.SliceT.Elem, use{name: w.SliceT.Name, elem: true})
+	case w.ArrayT != nil && token.IsIdentifier(w.ArrayT.Name):
+		dec.usedAs(w.ArrayT.Elem, use{name: w.ArrayT.Name, elem: true})
+	case w.MapT != nil && token.IsIdentifier(w.MapT.Name):
+		dec.usedAs(w.MapT.Elem, use{name: w.MapT.Name, elem: true})
+	}
+	if u, ok := dec.uses[id]; ok {
+		dec.nameFromContext(id, u)
+	}
+}
+
+// use is where a type is used for ContextNames: in the field called name of
+// the struct called parent, or as the elements of what is called name if
+// elem is set
+type use struct {
+	name, parent string
+	elem         bool
+}
+
+// usedAs records the first place id is used and names it if it has been
+// defined
+func (dec *Decoder) usedAs(id TypeID, u use) {
+	if _, ok := dec.uses[id]; ok || isBuiltin(id) {
+		return
+	}
+	if dec.uses == nil {
+		dec.uses = make(map[TypeID]use)
+	}
+	dec.uses[id] = u
+	if _, ok := dec.seenTypes[id]; ok {
+		dec.nameFromContext(id, u)
+	}
+}
+
+// nameFromContext names id after u if it is an anonymous struct, or passes
+// u on to what it holds if it is an unnamed slice, array or map
+func (dec *Decoder) nameFromContext(id TypeID, u use) {
+	w := dec.seenTypes[id]
+	elem := use{name: u.name, parent: u.parent, elem: true}
+	switch {
+	case w.StructT != nil:
+		if dec.fixedNames[id] || !(w.StructT.anonymous || !token.IsIdentifier(w.StructT.Name)) {
+			return
+		}
+		name := u.name
+		if u.elem {
+			name = singular(name)
+		}
+		name = dec.freeName(name, u.parent)
+		w.StructT.Name = name
+		dec.fixName(id)
+		if renamed, ok := dec.hintedName(name); ok {
+			w.StructT.Name = renamed
+			dec.fixHintedName(id)
+		}
+		dec.takeName(w.StructT.Name)
+	// encoding/gob calls these by their Go types, which would still have
+	// the struct in them, so they are written out in full instead
+	case w.SliceT != nil && !token.IsIdentifier(w.SliceT.Name):
+		w.SliceT.Name = ""
+		dec.usedAs(w.SliceT.Elem, elem)
+	case w.ArrayT != nil && !token.IsIdentifier(w.ArrayT.Name):
+		w.ArrayT.Name = ""
+		dec.usedAs(w.ArrayT.Elem, elem)
+	case w.MapT != nil && !token.IsIdentifier(w.MapT.Name):
+		w.MapT.Name = ""
+		dec.usedAs(w.MapT.Elem, elem)
+	}
+}
+
+func (dec *Decoder) fixName(id TypeID) {
+	if dec.fixedNames == nil {
+		dec.fixedNames = make(map[TypeID]bool)
+	}
+	dec.fixedNames[id] = true
+}
+
+// freeName returns name if no type in the session has it yet, or else
+// parent+name, or else name with the first number from 2 up that is free
+func (dec *Decoder) freeName(name, parent string) string {
+	// a name that was renamed is still taken so nothing else is renamed
+	// to the same thing
+	taken := func(name string) bool {
+		if dec.nameTaken(name) {
+			return true
+		}
+		renamed, ok := dec.hintedName(name)
+		return ok && dec.takenNames[renamed]
+	}
+	if !taken(name) {
+		return name
+	}
+	if parent != "" && !taken(parent+name) {
+		return parent + name
+	}
+	if dec.numbered == nil {
+		dec.numbered = make(map[string]int)
+	}
+	// carry on from the last number name got so lots of structs named
+	// after the same thing don't each count up from 2
+	i := dec.numbered[name] + 1
+	if i < 2 {
+		i = 2
+	}
+	for ; ; i++ {
+		if n := fmt.Sprintf("%s%d", name, i); !taken(n) {
+			dec.numbered[name] = i
+			return n
+		}
+	}
+}
+
+// nameTaken reports whether a type in the session has name
+func (dec *Decoder) nameTaken(name string) bool {
+	if dec.takenNames == nil {
+		dec.takenNames = make(map[string]bool, len(dec.seenTypes))
+		for _, w := range dec.seenTypes {
+			if c := w.Common(); c != nil {
+				dec.takenNames[c.Name] = true
+			}
+		}
+	}
+	return dec.takenNames[name]
+}
+
+// takeName marks name as used by a type once freeName has started keeping
+// track
+func (dec *Decoder) takeName(name string) {
+	if dec.takenNames != nil {
+		dec.takenNames[name] = true
+	}
+}
+
+// singular guesses the singular of a plural English name, or adds Elem
+// to it if it doesn't look plural
+func singular(name string) string {
+	switch {
+	case len(name) > 3 && strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case len(name) > 1 && strings.HasSuffix(name, "s") &&
+		!strings.HasSuffix(name, "ss") && !strings.HasSuffix(name, "us") && !strings.HasSuffix(name, "is"):
+		return name[:len(name)-1]
+	}
+	return name + "Elem"
+}
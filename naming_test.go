@@ -0,0 +1,173 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// anonNames decodes b and returns the names of its anonymous structs
+func anonNames(t *testing.T, b []byte, opts ...Option) []string {
+	t.Helper()
+	gobs, err := NewDecoder(bytes.NewReader(b), opts...).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, g := range gobs {
+		names = append(names, g.Value.(StructValue).Name())
+	}
+	return names
+}
+
+func TestNaming(t *testing.T) {
+	// encoding/gob remembers the names of types it has sent, so these are
+	// only used here
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []interface{}{
+		struct{ NamingA, NamingB int }{1, 2},
+		struct{ NamingC string }{"c"},
+		struct{ NamingA, NamingB int }{3, 4},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a second encoder sends the same first struct with another ID
+	enc = gob.NewEncoder(&buf)
+	if err := enc.Encode(struct{ NamingC string }{"d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(struct{ NamingA, NamingB int }{5, 6}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// encoding/gob gives a type the same ID in every encoder
+	ids := anonNames(t, b)
+	if !regexp.MustCompile(`^Anon[0-9]+$`).MatchString(ids[0]) || ids[0] != ids[2] || ids[0] != ids[4] || ids[1] != ids[3] || ids[0] == ids[1] {
+		t.Fatal("unexpected ID names", ids)
+	}
+	seq := anonNames(t, b, WithNaming(SequentialNames))
+	expected := []string{"Anon1", "Anon2", "Anon1", "Anon3", "Anon4"}
+	if !equalStrings(seq, expected) {
+		t.Fatalf("expected %v got %v", expected, seq)
+	}
+	hash := anonNames(t, b, WithNaming(HashNames))
+	if hash[0] != hash[4] || hash[1] != hash[3] || hash[0] == hash[1] {
+		t.Fatal("expected the same structs to have the same hash names", hash)
+	}
+	random := anonNames(t, b, WithNaming(RandomNames))
+	if !regexp.MustCompile(`^`+ids[0]+`_[0-9a-f]{8}$`).MatchString(random[0]) || random[0] != random[2] || random[0] == random[4] {
+		t.Fatal("unexpected random names", random)
+	}
+	seeded := anonNames(t, b, WithNamingSeed(7))
+	if again := anonNames(t, b, WithNamingSeed(7)); !equalStrings(seeded, again) {
+		t.Fatalf("expected the same seed to give %v got %v", seeded, again)
+	}
+}
+
+func TestNamingConcurrent(t *testing.T) {
+	b := encodeTest(t, struct{ A, B int }{1, 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n Naming) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := NewDecoder(bytes.NewReader(b), WithNaming(n)).Decode(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(Naming(i % 4))
+	}
+	wg.Wait()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type contextInner struct {
+	Address struct{ Zip int }
+}
+
+type contextItems []struct{ SKU string }
+
+type contextOrder struct {
+	Address  struct{ Street string }
+	Inner    contextInner
+	Items    []struct{ Qty int }
+	Entries  map[string]struct{ N int }
+	Boxes    [2]struct{ W int }
+	Status   []struct{ Code int }
+	Named    contextItems
+	Position struct{ X, Y float64 }
+}
+
+func TestContextNames(t *testing.T) {
+	v := contextOrder{Inner: contextInner{}, Named: contextItems{{"a"}}}
+	v.Address.Street = "s"
+	v.Inner.Address.Zip = 1
+	v.Items = append(v.Items, struct{ Qty int }{2})
+	v.Entries = map[string]struct{ N int }{"e": {3}}
+	v.Boxes[0].W = 4
+	v.Status = append(v.Status, struct{ Code int }{5})
+	v.Position.X = 6
+	b := encodeTest(t, v)
+
+	names := func(opts ...Option) map[string]string {
+		gobs, err := NewDecoder(bytes.NewReader(b), opts...).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]string)
+		for _, w := range gobs[0].Types {
+			if w.StructT != nil {
+				names[w.StructT.Field[0].Name] = w.StructT.Name
+			}
+		}
+		return names
+	}
+	expected := map[string]string{
+		"Street": "Address",
+		"Zip":    "contextInnerAddress",
+		"Qty":    "Item",
+		"N":      "Entry",
+		"W":      "Box",
+		"Code":   "StatusElem",
+		"SKU":    "contextItem",
+		"X":      "Position",
+	}
+	got := names(WithNaming(ContextNames))
+	for field, name := range expected {
+		if got[field] != name {
+			t.Errorf("expected the struct with %s to be %s got %s", field, name, got[field])
+		}
+	}
+
+	renames, err := ReadRenames(strings.NewReader("# comment\n\nItem LineItem\n  Anon99 Nothing\nAddress Home\ncontextInner Inner\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = names(WithNaming(ContextNames), WithRenames(renames))
+	if got["Qty"] != "LineItem" || got["Street"] != "Home" || got["Zip"] != "InnerAddress" {
+		t.Fatal("expected renames got", got)
+	}
+	if _, err := ReadRenames(strings.NewReader("Item Line Item\n")); err == nil {
+		t.Fatal("expected an error for a bad line")
+	}
+}
@@ -0,0 +1,203 @@
+package degob
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpaqueDecoder decodes the bytes a GobEncoder, BinaryMarshaler or
+// TextMarshaler type encoded itself to. It should return an error if the
+// bytes aren't what it expects so the value is left as raw bytes.
+type OpaqueDecoder func(b []byte) (DecodedOpaque, error)
+
+// DecodedOpaque is an opaque value that an OpaqueDecoder understood
+type DecodedOpaque interface {
+	// GoString is the value as Go source, like time.Date(...)
+	GoString() string
+	// JSON is the value as JSON
+	JSON() string
+}
+
+var opaqueDecoders = struct {
+	sync.RWMutex
+	m map[string]OpaqueDecoder
+}{m: make(map[string]OpaqueDecoder)}
+
+// RegisterOpaqueDecoder sets the decoder for opaque values whose type has
+// name on the wire, replacing whatever was registered for it. A nil decoder
+// removes it.
+//
+// There are decoders registered for `time.Time` (Time), `math/big`'s Int,
+// Float and Rat, `net/netip.Addr` (Addr) and `net/url.URL` (URL). The name is
+// the only thing there is to go on so it is worth removing these if the gobs
+// have types of their own with those names. Types whose methods have pointer
+// receivers are sent without a name when they are used through a pointer
+// (`*big.Int` for example) so they can't be matched.
+func RegisterOpaqueDecoder(name string, dec OpaqueDecoder) {
+	opaqueDecoders.Lock()
+	defer opaqueDecoders.Unlock()
+	if dec == nil {
+		delete(opaqueDecoders.m, name)
+		return
+	}
+	opaqueDecoders.m[name] = dec
+}
+
+// decodeOpaque returns nil if there is no decoder for name or it failed
+func decodeOpaque(name string, b []byte) DecodedOpaque {
+	opaqueDecoders.RLock()
+	dec, ok := opaqueDecoders.m[name]
+	opaqueDecoders.RUnlock()
+	if !ok {
+		return nil
+	}
+	d, err := dec(b)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+func init() {
+	RegisterOpaqueDecoder("Time", decodeTime)
+	RegisterOpaqueDecoder("Int", decodeBigInt)
+	RegisterOpaqueDecoder("Float", decodeBigFloat)
+	RegisterOpaqueDecoder("Rat", decodeBigRat)
+	RegisterOpaqueDecoder("Addr", decodeAddr)
+	RegisterOpaqueDecoder("URL", decodeURL)
+}
+
+type decodedTime time.Time
+
+func decodeTime(b []byte) (DecodedOpaque, error) {
+	var t time.Time
+	err := t.GobDecode(b)
+	return decodedTime(t), err
+}
+
+func (d decodedTime) GoString() string {
+	t := time.Time(d)
+	loc := "time.UTC"
+	if t.Location() != time.UTC {
+		_, offset := t.Zone()
+		loc = fmt.Sprintf("time.FixedZone(\"\", %d)", offset)
+	}
+	return fmt.Sprintf("time.Date(%d, time.%s, %d, %d, %d, %d, %d, %s)",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func (d decodedTime) JSON() string {
+	return strconv.Quote(time.Time(d).Format(time.RFC3339Nano))
+}
+
+type decodedBigInt struct{ *big.Int }
+
+func decodeBigInt(b []byte) (DecodedOpaque, error) {
+	i := new(big.Int)
+	err := i.GobDecode(b)
+	return decodedBigInt{i}, err
+}
+
+func (d decodedBigInt) GoString() string {
+	if d.IsInt64() {
+		return fmt.Sprintf("big.NewInt(%d)", d.Int64())
+	}
+	// SetString has two results, so wrap it to keep this one expression
+	return fmt.Sprintf("func() *big.Int { i, _ := new(big.Int).SetString(%q, 10); return i }()", d.String())
+}
+
+func (d decodedBigInt) JSON() string { return d.String() }
+
+type decodedBigFloat struct{ *big.Float }
+
+func decodeBigFloat(b []byte) (DecodedOpaque, error) {
+	f := new(big.Float)
+	err := f.GobDecode(b)
+	return decodedBigFloat{f}, err
+}
+
+func (d decodedBigFloat) GoString() string {
+	if d.IsInf() {
+		return fmt.Sprintf("new(big.Float).SetInf(%t)", d.Signbit())
+	}
+	if f, acc := d.Float64(); acc == big.Exact {
+		return fmt.Sprintf("big.NewFloat(%v)", f)
+	}
+	return fmt.Sprintf("func() *big.Float { f, _, _ := big.ParseFloat(%q, 10, %d, big.ToNearestEven); return f }()", d.Text('g', -1), d.Prec())
+}
+
+func (d decodedBigFloat) JSON() string { return strconv.Quote(d.Text('g', -1)) }
+
+type decodedBigRat struct{ *big.Rat }
+
+func decodeBigRat(b []byte) (DecodedOpaque, error) {
+	r := new(big.Rat)
+	err := r.GobDecode(b)
+	return decodedBigRat{r}, err
+}
+
+func (d decodedBigRat) GoString() string {
+	if d.Num().IsInt64() && d.Denom().IsInt64() {
+		return fmt.Sprintf("big.NewRat(%d, %d)", d.Num().Int64(), d.Denom().Int64())
+	}
+	return fmt.Sprintf("func() *big.Rat { r, _ := new(big.Rat).SetString(%q); return r }()", d.String())
+}
+
+func (d decodedBigRat) JSON() string { return strconv.Quote(d.String()) }
+
+type decodedAddr netip.Addr
+
+func decodeAddr(b []byte) (DecodedOpaque, error) {
+	var a netip.Addr
+	err := a.UnmarshalBinary(b)
+	return decodedAddr(a), err
+}
+
+func (d decodedAddr) GoString() string {
+	if !netip.Addr(d).IsValid() {
+		return "netip.Addr{}"
+	}
+	return fmt.Sprintf("netip.MustParseAddr(%q)", netip.Addr(d).String())
+}
+
+func (d decodedAddr) JSON() string { return strconv.Quote(netip.Addr(d).String()) }
+
+type decodedURL struct{ *url.URL }
+
+func decodeURL(b []byte) (DecodedOpaque, error) {
+	u := new(url.URL)
+	err := u.UnmarshalBinary(b)
+	return decodedURL{u}, err
+}
+
+func (d decodedURL) GoString() string {
+	var fields []string
+	add := func(name, val string) {
+		if val != "" {
+			fields = append(fields, fmt.Sprintf("%s: %q", name, val))
+		}
+	}
+	add("Scheme", d.Scheme)
+	add("Opaque", d.Opaque)
+	if d.User != nil {
+		if p, ok := d.User.Password(); ok {
+			fields = append(fields, fmt.Sprintf("User: url.UserPassword(%q, %q)", d.User.Username(), p))
+		} else {
+			fields = append(fields, fmt.Sprintf("User: url.User(%q)", d.User.Username()))
+		}
+	}
+	add("Host", d.Host)
+	add("Path", d.Path)
+	add("RawPath", d.RawPath)
+	add("RawQuery", d.RawQuery)
+	add("Fragment", d.Fragment)
+	return fmt.Sprintf("url.URL{%s}", strings.Join(fields, ", "))
+}
+
+func (d decodedURL) JSON() string { return strconv.Quote(d.String()) }
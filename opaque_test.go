@@ -0,0 +1,119 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type OpaqueSample struct {
+	When time.Time
+	Big  big.Int
+	Frac big.Rat
+	Addr netip.Addr
+	Link url.URL
+}
+
+type Celsius int
+
+func (c Celsius) GobEncode() ([]byte, error) { return []byte{byte(c)}, nil }
+func (c *Celsius) GobDecode(b []byte) error  { *c = Celsius(b[0]); return nil }
+
+type decodedCelsius byte
+
+func (c decodedCelsius) GoString() string { return "Celsius(" + string('0'+rune(c)) + ")" }
+func (c decodedCelsius) JSON() string     { return string('0' + rune(c)) }
+
+func opaqueGobTest(v interface{}, t *testing.T) *Gob {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gobs[0]
+}
+
+func TestOpaqueDecoders(t *testing.T) {
+	link, _ := url.Parse("https://example.com/a?b=c")
+	g := opaqueGobTest(&OpaqueSample{
+		When: time.Date(2024, time.March, 1, 12, 30, 0, 5, time.UTC),
+		Big:  *big.NewInt(-42),
+		Frac: *big.NewRat(1, 3),
+		Addr: netip.MustParseAddr("10.0.0.1"),
+		Link: *link,
+	}, t)
+	cmp(g.Display(SingleLine), `OpaqueSample{When: time.Date(2024, time.March, 1, 12, 30, 0, 5, time.UTC), Big: big.NewInt(-42), Frac: big.NewRat(1, 3), Addr: netip.MustParseAddr("10.0.0.1"), Link: url.URL{Scheme: "https", Host: "example.com", Path: "/a", RawQuery: "b=c"}}`, t)
+	cmp(g.Display(JSON), `{"When": "2024-03-01T12:30:00.000000005Z", "Big": -42, "Frac": "1/3", "Addr": "10.0.0.1", "Link": "https://example.com/a?b=c"}`, t)
+
+	// the raw bytes are still there
+	v, _ := g.Value.(StructValue).Field("Addr")
+	o := v.(OpaqueValue)
+	if !bytes.Equal(o.Bytes(), []byte{10, 0, 0, 1}) {
+		t.Fatalf("unexpected raw bytes %v", o.Bytes())
+	}
+	if o.Decoded() == nil {
+		t.Fatal("expected Addr to be decoded")
+	}
+}
+
+func TestOpaqueBigExpressions(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	for _, d := range []DecodedOpaque{
+		decodedBigInt{huge},
+		decodedBigFloat{new(big.Float).SetPrec(200).Quo(big.NewFloat(1), big.NewFloat(3))},
+		decodedBigRat{new(big.Rat).SetFrac(huge, big.NewInt(7))},
+		decodedBigFloat{new(big.Float).SetInf(false)},
+		decodedBigFloat{new(big.Float).SetInf(true)},
+	} {
+		expr := d.GoString()
+		src := "package p\n\nimport \"math/big\"\n\nvar _ = " + expr + "\n"
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "p.go", src, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		conf := types.Config{Importer: importer.Default()}
+		if _, err := conf.Check("p", fset, []*ast.File{f}, nil); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		}
+	}
+	cmp(decodedBigFloat{new(big.Float).SetInf(true)}.GoString(), "new(big.Float).SetInf(true)", t)
+}
+
+func TestRegisterOpaqueDecoder(t *testing.T) {
+	g := opaqueGobTest(Celsius(7), t)
+	if g.Value.(OpaqueValue).Decoded() != nil {
+		t.Fatal("nothing should have decoded Celsius")
+	}
+	cmp(g.Display(SingleLine), "[]byte{0x7}", t)
+
+	RegisterOpaqueDecoder("Celsius", func(b []byte) (DecodedOpaque, error) {
+		if len(b) != 1 {
+			return nil, errors.New("expected one byte")
+		}
+		return decodedCelsius(b[0]), nil
+	})
+	defer RegisterOpaqueDecoder("Celsius", nil)
+	g = opaqueGobTest(Celsius(7), t)
+	cmp(g.Display(SingleLine), "Celsius(7)", t)
+	cmp(g.Display(JSON), "7", t)
+
+	// failing to decode leaves the bytes
+	if err := g.Set(".", "0x0102"); err != nil {
+		t.Fatal(err)
+	}
+	cmp(g.Display(SingleLine), "[]byte{0x1, 0x2}", t)
+}
@@ -0,0 +1,131 @@
+package degob
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DecoderOptions limits how much a Decoder will do for its input so that
+// a small hostile gob can't make it allocate gigabytes or recurse until the
+// stack runs out. A limit that is hit stops decoding with an *Error wrapping
+// one of the ErrXxx errors below, so errors.Is can tell which one it was.
+//
+// A zero field uses the value from DefaultDecoderOptions.
+type DecoderOptions struct {
+	// MaxMessageSize is the largest message length that will be read.
+	MaxMessageSize uint64
+	// MaxElements is the most elements a slice, array or map can have and
+	// the most fields a struct type can have.
+	MaxElements int
+	// MaxDepth is how deeply values and types can be nested.
+	MaxDepth int
+	// MaxAlloc is about how many bytes decoding a single gob can allocate
+	// for its strings, byte slices and values, including the zero values
+	// of fields that weren't sent.
+	MaxAlloc int64
+}
+
+// DefaultDecoderOptions returns the limits a Decoder has unless SetOptions
+// is used. They are well beyond anything a normal gob needs while keeping
+// what a hostile one can make a Decoder allocate to around a hundred
+// megabytes.
+func DefaultDecoderOptions() DecoderOptions {
+	return DecoderOptions{
+		MaxMessageSize: 32 << 20,
+		MaxElements:    1 << 20,
+		MaxDepth:       1000,
+		MaxAlloc:       64 << 20,
+	}
+}
+
+var (
+	// ErrMessageTooBig is a message length over MaxMessageSize
+	ErrMessageTooBig = errors.New("message is bigger than MaxMessageSize")
+	// ErrTooManyElements is a slice, array, map or struct type that has more
+	// than MaxElements elements or fields
+	ErrTooManyElements = errors.New("more than MaxElements elements")
+	// ErrTooDeep is a value or type nested more than MaxDepth deep
+	ErrTooDeep = errors.New("nested deeper than MaxDepth")
+	// ErrAllocLimit is a gob that needs more than MaxAlloc bytes
+	ErrAllocLimit = errors.New("gob needs more than MaxAlloc bytes")
+)
+
+// about how many bytes a Value takes
+const valueCost = 32
+
+// Option configures a Decoder made by NewDecoder
+type Option func(*Decoder)
+
+// WithLimits is SetOptions as an Option
+func WithLimits(opts DecoderOptions) Option {
+	return func(dec *Decoder) {
+		dec.SetOptions(opts)
+	}
+}
+
+// WithStrict makes the Decoder fail on input that a gob.Encoder wouldn't
+// have written even where it can make sense of it: a message with more
+// after the type it defines or the value it holds, and types defined again
+// by a new encoder writing to the same stream. Types from WithTypes can
+// still be defined again.
+func WithStrict() Option {
+	return func(dec *Decoder) {
+		dec.strict = true
+	}
+}
+
+// SetOptions sets the limits for everything decoded after it is called
+func (dec *Decoder) SetOptions(opts DecoderOptions) {
+	def := DefaultDecoderOptions()
+	if opts.MaxMessageSize == 0 {
+		opts.MaxMessageSize = def.MaxMessageSize
+	}
+	if opts.MaxElements == 0 {
+		opts.MaxElements = def.MaxElements
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = def.MaxDepth
+	}
+	if opts.MaxAlloc == 0 {
+		opts.MaxAlloc = def.MaxAlloc
+	}
+	dec.opts = opts
+}
+
+// allocate charges n bytes to the current gob and reports whether that was
+// within MaxAlloc
+func (dec *Decoder) allocate(n int64) bool {
+	if dec.err != nil {
+		return false
+	}
+	dec.alloc += n
+	if n < 0 || dec.alloc > dec.opts.MaxAlloc {
+		dec.err = dec.genError(fmt.Errorf("%w (%d)", ErrAllocLimit, dec.opts.MaxAlloc))
+		return false
+	}
+	return true
+}
+
+// checkElements makes sure n is within MaxElements
+func (dec *Decoder) checkElements(n uint64) bool {
+	if dec.err != nil {
+		return false
+	}
+	if n > uint64(dec.opts.MaxElements) {
+		dec.err = dec.genError(fmt.Errorf("%w: %d > %d", ErrTooManyElements, n, dec.opts.MaxElements))
+		return false
+	}
+	return true
+}
+
+// checkDepth makes sure depth is within MaxDepth
+func (dec *Decoder) checkDepth(depth int) bool {
+	if dec.err != nil {
+		return false
+	}
+	if depth > dec.opts.MaxDepth {
+		dec.err = dec.genError(fmt.Errorf("%w (%d)", ErrTooDeep, dec.opts.MaxDepth))
+		return false
+	}
+	return true
+}
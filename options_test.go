@@ -0,0 +1,160 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func encodeTest(t *testing.T, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal("encoding", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecoderOptions(t *testing.T) {
+	type Node struct {
+		V    int
+		Next *Node
+	}
+	var deep *Node
+	for i := 0; i < 50; i++ {
+		deep = &Node{V: i, Next: deep}
+	}
+	type Big struct {
+		A [1 << 16]int
+		B [1 << 16]int
+	}
+	type Huge struct {
+		A int
+		B *[1 << 24]int64
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		opts     DecoderOptions
+		expected error
+	}{
+		{
+			// a length prefix of 2^56 with nothing after it
+			name:     "huge message",
+			data:     []byte{0xf8, 0x01, 0, 0, 0, 0, 0, 0, 0},
+			expected: ErrMessageTooBig,
+		},
+		{
+			name:     "message size",
+			data:     encodeTest(t, strings.Repeat("a", 100)),
+			opts:     DecoderOptions{MaxMessageSize: 50},
+			expected: ErrMessageTooBig,
+		},
+		{
+			// the nil array still gets a zero value
+			name:     "default elements",
+			data:     encodeTest(t, Huge{A: 1}),
+			expected: ErrTooManyElements,
+		},
+		{
+			name:     "slice elements",
+			data:     encodeTest(t, make([]int, 100)),
+			opts:     DecoderOptions{MaxElements: 10},
+			expected: ErrTooManyElements,
+		},
+		{
+			name:     "map elements",
+			data:     encodeTest(t, map[int]int{1: 1, 2: 2, 3: 3}),
+			opts:     DecoderOptions{MaxElements: 2},
+			expected: ErrTooManyElements,
+		},
+		{
+			name:     "value depth",
+			data:     encodeTest(t, deep),
+			opts:     DecoderOptions{MaxDepth: 20},
+			expected: ErrTooDeep,
+		},
+		{
+			name:     "type depth",
+			data:     encodeTest(t, [][][][][]int{}),
+			opts:     DecoderOptions{MaxDepth: 3},
+			expected: ErrTooDeep,
+		},
+		{
+			name:     "string",
+			data:     encodeTest(t, strings.Repeat("a", 1000)),
+			opts:     DecoderOptions{MaxAlloc: 500},
+			expected: ErrAllocLimit,
+		},
+		{
+			// the unsent arrays are all zero values which still cost
+			name:     "zero values",
+			data:     encodeTest(t, Big{}),
+			opts:     DecoderOptions{MaxAlloc: 1 << 20},
+			expected: ErrAllocLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(tt.data))
+			dec.SetOptions(tt.opts)
+			_, err := dec.Decode()
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v got %v", tt.expected, err)
+			}
+			if _, ok := err.(*Error); !ok {
+				t.Fatalf("expected *Error got %T", err)
+			}
+			_, err = NewDecoder(bytes.NewReader(tt.data), WithLimits(tt.opts)).Decode()
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("WithLimits expected %v got %v", tt.expected, err)
+			}
+			// and the defaults are fine with anything that isn't hostile
+			if tt.opts == (DecoderOptions{}) {
+				return
+			}
+			if _, err := NewDecoder(bytes.NewReader(tt.data)).Decode(); err != nil {
+				t.Fatal("default options:", err)
+			}
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	type T struct{ A int }
+	one := encodeTest(t, T{1})
+	two := append(append([]byte{}, one...), encodeTest(t, T{2})...)
+	// an int with a byte after it that the length includes
+	extra := append([]byte{}, encodeTest(t, 5)...)
+	extra[0]++
+	extra = append(extra, 0)
+	table, err := ReadTypeTable(bytes.NewReader(one))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		opts     []Option
+		expected error
+	}{
+		{name: "two encoders", data: two, expected: errDuplicateType(0, nil).Err},
+		{name: "extra data", data: extra, expected: errExtraData},
+		{name: "table types", data: one, opts: []Option{WithTypes(table)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder(bytes.NewReader(tt.data), tt.opts...).Decode(); err != nil {
+				t.Fatal("not strict:", err)
+			}
+			_, err := NewDecoder(bytes.NewReader(tt.data), append(tt.opts, WithStrict())...).Decode()
+			switch {
+			case tt.expected == nil && err != nil:
+				t.Fatal(err)
+			case tt.expected != nil && (err == nil || err.(*Error).Err.Error() != tt.expected.Error()):
+				t.Fatalf("expected %v got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package degob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// PushDecoder decodes gobs from bytes written to it instead of reading them
+// from an io.Reader, for proxies and event loops that get the bytes in
+// whatever chunks the network gives them. Write never blocks. It keeps the
+// bytes of a gob until all of it has arrived, which can be several messages
+// since a value can go on after the definition of a type in an interface,
+// and decodes every Gob that is complete.
+//
+// Errors are dealt with the way DecodeStream deals with them: the gob that
+// had one is dropped and decoding carries on after it when it can.
+type PushDecoder struct {
+	dec   *Decoder
+	buf   []byte        // everything since the last gob that was finished
+	tried int           // how much of buf was decoded without finishing one
+	start *decoderState // the decoder as it was at the start of buf
+	fn    func(Result)
+	queue []Result
+	err   *Error // what stopped the decoder for good
+}
+
+// NewPushDecoder returns a PushDecoder that calls fn with every Gob and
+// error from inside Write. If fn is nil they are queued for Results instead.
+// The Options are for the underlying Decoder.
+func NewPushDecoder(fn func(Result), opts ...Option) *PushDecoder {
+	dec := NewDecoder(nil, opts...)
+	dec.r = bytes.NewReader(nil)
+	return &PushDecoder{dec: dec, fn: fn}
+}
+
+// SetOptions sets the limits of the underlying Decoder. A message bigger
+// than MaxMessageSize is an error as soon as its length arrives rather than
+// being buffered.
+func (p *PushDecoder) SetOptions(opts DecoderOptions) {
+	p.dec.SetOptions(opts)
+}
+
+// RecordSpans is Decoder.RecordSpans
+func (p *PushDecoder) RecordSpans(on bool) {
+	p.dec.RecordSpans(on)
+}
+
+// Write decodes every gob that p completes. It only returns an error if an
+// earlier one left nothing more that could be decoded, in which case that
+// *Error is returned and p is dropped.
+func (p *PushDecoder) Write(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	p.buf = append(p.buf, b...)
+	n := p.complete()
+	if n == p.tried {
+		// no new messages to try
+		return len(b), nil
+	}
+	if p.start == nil {
+		p.start = p.dec.save()
+	}
+	r := bytes.NewReader(p.buf[:n])
+	p.dec.r = r
+	used := 0
+	for {
+		g, err := p.dec.nextGob(nil)
+		if g == nil && err == nil {
+			break
+		}
+		if err != nil && err.Err == io.EOF {
+			// a value went on into a message that hasn't arrived
+			break
+		}
+		if err != nil && p.dec.done {
+			p.err = err
+		}
+		p.emit(Result{Gob: g, Err: err})
+		used = n - r.Len()
+		p.start = p.dec.save()
+	}
+	if p.err != nil {
+		return len(b), nil
+	}
+	// anything after the last gob is decoded again with the messages
+	// that finish it
+	p.dec.restore(p.start)
+	p.buf = append(p.buf[:0], p.buf[used:]...)
+	p.tried = n - used
+	return len(b), nil
+}
+
+// decoderState is enough of a Decoder to start a gob over. The types are
+// copies because naming them changes them.
+type decoderState struct {
+	seenTypes      map[TypeID]*WireType
+	tableTypes     bool
+	bytesProcessed uint64
+	messages       int
+	streamPos      int64
+	skipping       bool
+	names          namingState
+}
+
+func (dec *Decoder) save() *decoderState {
+	s := &decoderState{
+		seenTypes:      make(map[TypeID]*WireType, len(dec.seenTypes)),
+		tableTypes:     dec.tableTypes,
+		bytesProcessed: dec.bytesProcessed,
+		messages:       dec.messages,
+		streamPos:      dec.streamPos,
+		skipping:       dec.skipping,
+		names:          dec.namingState.clone(),
+	}
+	copyTypes(s.seenTypes, dec.seenTypes)
+	return s
+}
+
+func (dec *Decoder) restore(s *decoderState) {
+	dec.seenTypes = make(map[TypeID]*WireType, len(s.seenTypes))
+	copyTypes(dec.seenTypes, s.seenTypes)
+	dec.tableTypes = s.tableTypes
+	dec.bytesProcessed = s.bytesProcessed
+	dec.messages = s.messages
+	dec.streamPos = s.streamPos
+	dec.skipping = s.skipping
+	dec.namingState = s.names.clone()
+	dec.err = nil
+	dec.done = false
+	dec.inValue = false
+	dec.clearGob()
+}
+
+// complete returns how many of the buffered bytes are whole messages. A
+// message that is too big or a length that can't be read is passed on
+// for the decoder to report.
+func (p *PushDecoder) complete() int {
+	var into [9]byte
+	off := 0
+	for off < len(p.buf) {
+		var read uint64
+		size, width, err := readUint(bytes.NewReader(p.buf[off:]), into[:], &read)
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// the length hasn't all arrived
+				return off
+			}
+			return len(p.buf)
+		}
+		if size > p.dec.opts.MaxMessageSize {
+			return off + width
+		}
+		if uint64(len(p.buf)-off-width) < size {
+			return off
+		}
+		off += width + int(size)
+	}
+	return off
+}
+
+func (p *PushDecoder) emit(r Result) {
+	if p.fn != nil {
+		p.fn(r)
+		return
+	}
+	p.queue = append(p.queue, r)
+}
+
+// Results returns the queued Gobs and errors and empties the queue. There
+// are only any if the PushDecoder was made without a callback.
+func (p *PushDecoder) Results() []Result {
+	q := p.queue
+	p.queue = nil
+	return q
+}
+
+// Buffered is how many bytes of an unfinished gob are being held
+func (p *PushDecoder) Buffered() int {
+	return len(p.buf)
+}
+
+// Close reports whether the input ended cleanly. It is an *Error wrapping
+// io.ErrUnexpectedEOF if part of a message or value was left over. Type
+// definitions with no value after them are fine, the same as for Decode.
+func (p *PushDecoder) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tried < len(p.buf) {
+		return p.dec.genError(io.ErrUnexpectedEOF)
+	}
+	if p.tried == 0 {
+		return nil
+	}
+	// the whole messages might still be the start of a value
+	p.dec.r = bytes.NewReader(p.buf)
+	_, err := p.dec.nextGob(nil)
+	p.dec.restore(p.start)
+	if err != nil {
+		err.Err = io.ErrUnexpectedEOF
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package degob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pushTest(t *testing.T, chunks ...[]byte) []*Gob {
+	return pushTestWith(t, nil, chunks...)
+}
+
+func pushTestWith(t *testing.T, opts []Option, chunks ...[]byte) []*Gob {
+	var gobs []*Gob
+	p := NewPushDecoder(func(r Result) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		gobs = append(gobs, r.Gob)
+	}, opts...)
+	for _, c := range chunks {
+		n, err := p.Write(c)
+		if err != nil || n != len(c) {
+			t.Fatalf("wrote %d of %d: %v", n, len(c), err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return gobs
+}
+
+func compareDisplay(t *testing.T, expected, got []*Gob) {
+	t.Helper()
+	if len(expected) != len(got) {
+		t.Fatalf("expected %d gobs got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		e := expected[i].Value.Display(SingleLine)
+		g := got[i].Value.Display(SingleLine)
+		if e != g {
+			t.Fatalf("gob %d: expected\n%s\ngot\n%s", i, e, g)
+		}
+		if e, g := typesString(expected[i]), typesString(got[i]); e != g {
+			t.Fatalf("gob %d: expected the types\n%s\ngot\n%s", i, e, g)
+		}
+	}
+}
+
+func typesString(g *Gob) string {
+	var b bytes.Buffer
+	if err := g.WriteTypes(&b); err != nil {
+		return err.Error()
+	}
+	return b.String()
+}
+
+func TestPushDecoder(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("test_examples", "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := make(map[string][]byte)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[filepath.Base(file)] = b
+	}
+	v := contextOrder{Named: contextItems{{"a"}}}
+	v.Items = append(v.Items, struct{ Qty int }{2})
+	inputs["anonymous"] = append(encodeTest(t, v), encodeTest(t, struct{ A, B int }{1, 2})...)
+	// naming has to come out the same however the bytes arrive
+	namings := map[string][]Option{
+		"ids":        nil,
+		"sequential": {WithNaming(SequentialNames)},
+		"seeded":     {WithNamingSeed(3)},
+		"context":    {WithNaming(ContextNames)},
+		"hash":       {WithNaming(HashNames)},
+	}
+	for name, b := range inputs {
+		for naming, opts := range namings {
+			t.Run(name+"/"+naming, func(t *testing.T) {
+				expected, err := NewDecoder(bytes.NewReader(b), opts...).Decode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i <= len(b); i++ {
+					compareDisplay(t, expected, pushTestWith(t, opts, b[:i], b[i:]))
+				}
+				var bytewise [][]byte
+				for i := range b {
+					bytewise = append(bytewise, b[i:i+1])
+				}
+				compareDisplay(t, expected, pushTestWith(t, opts, bytewise...))
+			})
+		}
+	}
+}
+
+func TestPushDecoderErrors(t *testing.T) {
+	obj := testObjects[0]
+	var buf bytes.Buffer
+	fileToBufferTest(obj.fileName, &buf, t)
+	b := buf.Bytes()
+
+	p := NewPushDecoder(nil)
+	p.Write(b[:len(b)-1])
+	if res := p.Results(); len(res) != 0 {
+		t.Fatal("expected no results for an incomplete gob got", res)
+	}
+	if err := p.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("expected unexpected EOF got", err)
+	}
+	p.Write(b[len(b)-1:])
+	if res := p.Results(); len(res) != 1 || res[0].Err != nil {
+		t.Fatal("expected the gob got", res)
+	}
+	if p.Buffered() != 0 {
+		t.Fatal("expected nothing buffered got", p.Buffered())
+	}
+
+	// the map value goes on after the first message it is in
+	im, err := os.ReadFile(filepath.Join("test_examples", "interfacemap.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = NewPushDecoder(nil)
+	p.Write(im[:0x83])
+	if res := p.Results(); len(res) != 0 {
+		t.Fatal("expected no results for an unfinished value got", res)
+	}
+	if err := p.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("expected unexpected EOF got", err)
+	}
+	p.Write(im[0x83:])
+	if res := p.Results(); len(res) != 1 || res[0].Err != nil {
+		t.Fatal("expected the gob got", res)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a message that is too big is never buffered
+	p = NewPushDecoder(nil)
+	p.SetOptions(DecoderOptions{MaxMessageSize: 10})
+	p.Write(b)
+	res := p.Results()
+	if len(res) != 1 || !errors.Is(res[0].Err, ErrMessageTooBig) {
+		t.Fatal("expected ErrMessageTooBig got", res)
+	}
+	if _, err := p.Write(b); !errors.Is(err, ErrMessageTooBig) {
+		t.Fatal("expected writing after to fail got", err)
+	}
+}
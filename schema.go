@@ -0,0 +1,423 @@
+package degob
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Schema is the types declared by the Go source of a package, which often
+// has some of the types the gobs were encoded from. A Decoder made
+// WithSchema matches the gobs' structs to the Schema's structs with the
+// same names, or to the only one with the same fields if the gob's struct
+// is anonymous, and gives their fields the types they are declared with
+// wherever those can hold what was sent. That is what gobs don't say: how
+// big numbers are, bytes, pointers and named types like time.Duration.
+// Everything else keeps the types it would have had.
+type Schema struct {
+	pkg     *types.Package
+	info    *types.Info
+	specs   map[*types.TypeName]*ast.TypeSpec
+	structs map[string]*schemaStruct
+}
+
+// schemaImporter imports a package from its export data, which is much
+// faster, and only from source if that fails
+type schemaImporter struct {
+	export, source types.Importer
+}
+
+func (imp schemaImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, "", 0)
+}
+
+func (imp schemaImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if pkg, err := importFrom(imp.export, path, dir, mode); err == nil {
+		return pkg, nil
+	}
+	return importFrom(imp.source, path, dir, mode)
+}
+
+func importFrom(imp types.Importer, path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if from, ok := imp.(types.ImporterFrom); ok {
+		return from.ImportFrom(path, dir, mode)
+	}
+	return imp.Import(path)
+}
+
+type schemaStruct struct {
+	name *types.TypeName
+	// by the names encoding/gob sends them with
+	fields map[string]*types.Var
+	exprs  map[string]ast.Expr
+}
+
+// ParseSchema reads the Schema of the package in dir. Tests and files the
+// build constraints leave out are skipped. The package doesn't have to
+// compile, the types that can't be worked out, like the ones from packages
+// that can't be found, just don't match anything. Imported packages come
+// from their export data when the go command can build it and are type
+// checked from source otherwise, which can take seconds for big ones.
+func ParseSchema(dir string) (*Schema, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 && f.Name.Name != files[0].Name.Name {
+			return nil, fmt.Errorf("%s has the packages %s and %s", dir, files[0].Name.Name, f.Name.Name)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s has no Go files", dir)
+	}
+	s := &Schema{
+		info: &types.Info{
+			Defs: make(map[*ast.Ident]types.Object),
+			Uses: make(map[*ast.Ident]types.Object),
+		},
+		specs:   make(map[*types.TypeName]*ast.TypeSpec),
+		structs: make(map[string]*schemaStruct),
+	}
+	conf := types.Config{
+		Importer: schemaImporter{
+			export: importer.Default(),
+			source: importer.ForCompiler(fset, "source", nil),
+		},
+		// partial source is bound to have errors
+		Error: func(error) {},
+	}
+	s.pkg, _ = conf.Check(files[0].Name.Name, fset, files, s.info)
+	for _, f := range files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				tn, ok := s.info.Defs[ts.Name].(*types.TypeName)
+				if !ok || ts.TypeParams != nil {
+					continue
+				}
+				s.specs[tn] = ts
+				st, ok := ts.Type.(*ast.StructType)
+				if ok && !ts.Assign.IsValid() {
+					s.structs[tn.Name()] = newSchemaStruct(tn, st)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func newSchemaStruct(tn *types.TypeName, st *ast.StructType) *schemaStruct {
+	ss := &schemaStruct{name: tn, exprs: make(map[string]ast.Expr)}
+	t, ok := tn.Type().Underlying().(*types.Struct)
+	if !ok {
+		ss.fields = make(map[string]*types.Var)
+		return ss
+	}
+	ss.fields = gobFields(t)
+	// the fields are in the same order as they are in the source
+	i := 0
+	for _, f := range st.Fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for ; n > 0 && i < t.NumFields(); n-- {
+			ss.exprs[t.Field(i).Name()] = f.Type
+			i++
+		}
+	}
+	return ss
+}
+
+// gobFields returns the fields of t that encoding/gob sends by their names
+func gobFields(t *types.Struct) map[string]*types.Var {
+	fields := make(map[string]*types.Var)
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		switch deref(f.Type()).Underlying().(type) {
+		case *types.Chan, *types.Signature:
+			continue
+		}
+		fields[f.Name()] = f
+	}
+	return fields
+}
+
+// fieldsFit reports whether every field of st is one of fields and, if
+// exact is set, every one of fields is one of st's
+func fieldsFit(st *StructType, fields map[string]*types.Var, exact bool) bool {
+	if exact && len(st.Field) != len(fields) {
+		return false
+	}
+	for _, f := range st.Field {
+		if _, ok := fields[f.wire()]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func deref(t types.Type) types.Type {
+	for {
+		p, ok := t.Underlying().(*types.Pointer)
+		if !ok {
+			return t
+		}
+		t = p.Elem()
+	}
+}
+
+// WithSchema makes the Decoder use the types in s where they match the ones
+// it reads. Names from Hints win over the Schema's, and so do the types
+// of fields that the Hints give.
+func WithSchema(s *Schema) Option {
+	return func(dec *Decoder) {
+		dec.schema = s
+	}
+}
+
+// matchSchema matches the struct id to the Schema's struct with its name
+// or, if its name was made up, renames it to the only one with its fields
+func (dec *Decoder) matchSchema(id TypeID, w *WireType) {
+	st := w.StructT
+	if ss, ok := dec.schema.structs[st.Name]; ok && fieldsFit(st, ss.fields, false) {
+		dec.matchedSchema(id, ss)
+		return
+	}
+	madeUp := st.anonymous || !token.IsIdentifier(st.Name) || dec.fixedNames[id]
+	if !madeUp || dec.hintedNames[id] {
+		return
+	}
+	var match *schemaStruct
+	for _, ss := range dec.schema.structs {
+		if fieldsFit(st, ss.fields, true) {
+			if match != nil {
+				// there's no telling which it is
+				return
+			}
+			match = ss
+		}
+	}
+	if match == nil || dec.nameTaken(match.name.Name()) {
+		return
+	}
+	st.Name = match.name.Name()
+	st.anonymous = false
+	dec.fixName(id)
+	dec.takeName(st.Name)
+	dec.matchedSchema(id, match)
+}
+
+func (dec *Decoder) matchedSchema(id TypeID, ss *schemaStruct) {
+	if dec.schemaTypes == nil {
+		dec.schemaTypes = make(map[TypeID]*schemaStruct)
+	}
+	dec.schemaTypes[id] = ss
+}
+
+// schemaFields gives the fields of w, which matched ss, the types they are
+// declared with if those can hold what was sent
+func (dec *Decoder) schemaFields(w *WireType, ss *schemaStruct) {
+	for _, f := range w.StructT.Field {
+		v, ok := ss.fields[f.wire()]
+		if !ok || !dec.fits(f.Id, v.Type(), make(map[fit]bool)) {
+			continue
+		}
+		if t, ok := dec.schema.goType(ss.exprs[f.wire()]); ok {
+			f.hint = t
+		}
+	}
+}
+
+type fit struct {
+	id TypeID
+	t  types.Type
+}
+
+// fits reports whether a value sent as id can be decoded into a t
+func (dec *Decoder) fits(id TypeID, t types.Type, seen map[fit]bool) bool {
+	// encoding/gob follows pointers
+	t = deref(t)
+	if seen[fit{id, t}] {
+		return true
+	}
+	seen[fit{id, t}] = true
+	u := t.Underlying()
+	switch id {
+	case BoolID, IntID, UintID, FloatID, ComplexID, StringID:
+		b, ok := u.(*types.Basic)
+		if !ok {
+			return false
+		}
+		info := b.Info()
+		switch id {
+		case BoolID:
+			return info&types.IsBoolean != 0
+		case IntID:
+			return info&types.IsInteger != 0 && info&types.IsUnsigned == 0
+		case UintID:
+			return info&types.IsUnsigned != 0
+		case FloatID:
+			return info&types.IsFloat != 0
+		case ComplexID:
+			return info&types.IsComplex != 0
+		}
+		return info&types.IsString != 0
+	case BytesID:
+		s, ok := u.(*types.Slice)
+		if !ok {
+			return false
+		}
+		b, ok := s.Elem().Underlying().(*types.Basic)
+		return ok && b.Kind() == types.Uint8
+	case InterfaceID:
+		// the types registered for an interface with methods would need
+		// them too
+		i, ok := u.(*types.Interface)
+		return ok && i.Empty()
+	}
+	w, ok := dec.seenTypes[id]
+	if !ok || id.IsBuiltin() {
+		return false
+	}
+	if w.Kind() == Opaque {
+		method := "MarshalText"
+		switch {
+		case w.GobEncoderT != nil:
+			method = "GobEncode"
+		case w.BinaryMarshalerT != nil:
+			method = "MarshalBinary"
+		}
+		obj, _, _ := types.LookupFieldOrMethod(t, true, nil, method)
+		if _, ok := obj.(*types.Func); !ok {
+			return false
+		}
+		// the Schema's own types have to be called what the gob calls them
+		// for WriteSource to declare them
+		n, ok := t.(*types.Named)
+		return !ok || n.Obj().Pkg() != dec.schema.pkg || n.Obj().Name() == w.Common().Name
+	}
+	switch {
+	case w.StructT != nil:
+		if n, ok := t.(*types.Named); ok {
+			ss := dec.schemaTypes[id]
+			return ss != nil && ss.name == n.Obj()
+		}
+		s, ok := u.(*types.Struct)
+		if !ok {
+			return false
+		}
+		fields := gobFields(s)
+		if !fieldsFit(w.StructT, fields, true) {
+			return false
+		}
+		for _, f := range w.StructT.Field {
+			if !dec.fits(f.Id, fields[f.wire()].Type(), seen) {
+				return false
+			}
+		}
+		return true
+	case w.SliceT != nil:
+		s, ok := u.(*types.Slice)
+		return ok && dec.fits(w.SliceT.Elem, s.Elem(), seen)
+	case w.ArrayT != nil:
+		a, ok := u.(*types.Array)
+		return ok && a.Len() == int64(w.ArrayT.Len) && dec.fits(w.ArrayT.Elem, a.Elem(), seen)
+	case w.MapT != nil:
+		m, ok := u.(*types.Map)
+		return ok && dec.fits(w.MapT.Key, m.Key(), seen) && dec.fits(w.MapT.Elem, m.Elem(), seen)
+	}
+	return false
+}
+
+// goType spells expr the way the source does, with the imports and the
+// declarations of the Schema's types that aren't structs that it needs.
+// Structs come from the gobs. It is false if expr uses anything else from
+// the Schema, like a constant for the length of an array.
+func (s *Schema) goType(expr ast.Expr) (*goType, bool) {
+	t := &goType{expr: types.ExprString(expr), decls: make(map[string]string)}
+	imports := make(map[string]bool)
+	if !s.uses(expr, t, imports) {
+		return nil, false
+	}
+	for imp := range imports {
+		t.imports = append(t.imports, imp)
+	}
+	sort.Strings(t.imports)
+	return t, true
+}
+
+func (s *Schema) uses(expr ast.Expr, t *goType, imports map[string]bool) bool {
+	ok := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			x, _ := n.X.(*ast.Ident)
+			if pn, isPkg := s.info.Uses[x].(*types.PkgName); x != nil && isPkg {
+				imp := fmt.Sprintf("%q", pn.Imported().Path())
+				if pn.Name() != pn.Imported().Name() {
+					imp = pn.Name() + " " + imp
+				}
+				imports[imp] = true
+				return false
+			}
+		case *ast.Ident:
+			obj := s.info.Uses[n]
+			if obj == nil || obj.Pkg() != s.pkg || s.pkg == nil {
+				return true
+			}
+			tn, isType := obj.(*types.TypeName)
+			ts := s.specs[tn]
+			if !isType || ts == nil {
+				ok = false
+				return false
+			}
+			if _, isStruct := tn.Type().Underlying().(*types.Struct); isStruct && !tn.IsAlias() {
+				return true
+			}
+			if _, done := t.decls[tn.Name()]; done {
+				return true
+			}
+			decl := "type " + tn.Name() + " "
+			if ts.Assign.IsValid() {
+				decl += "= "
+			}
+			t.decls[tn.Name()] = decl + types.ExprString(ts.Type)
+			if !s.uses(ts.Type, t, imports) {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
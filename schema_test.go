@@ -0,0 +1,158 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaStatus uint8
+
+type schemaStatuses []schemaStatus
+
+type schemaItem struct {
+	SKU string
+	Qty uint16
+}
+
+type schemaOrder struct {
+	ID     int32
+	Flags  byte
+	Status schemaStatus
+	Next   *schemaOrder
+	Wait   time.Duration
+	Items  []*schemaItem
+	Meta   json.RawMessage
+	Tags   schemaStatuses
+	Size   [2]int16
+	Count  int
+	Where  []struct{ X, Y float32 }
+	Other  struct{ A, B int }
+}
+
+const schemaSource = `package models
+
+import (
+	"encoding/json"
+	tm "time"
+)
+
+const N = 2
+
+type schemaStatus uint8
+
+type schemaStatuses []schemaStatus
+
+type schemaItem struct {
+	SKU string
+	Qty uint16
+}
+
+type schemaPoint struct {
+	X, Y float32
+}
+
+type schemaOrder struct {
+	ID     int32
+	Flags  byte
+	Status schemaStatus
+	Next   *schemaOrder
+	Wait   tm.Duration
+	Items  []*schemaItem
+	Meta   json.RawMessage
+	Tags   schemaStatuses
+	Size   [N]int16
+	Count  string
+	Where  []schemaPoint
+	Other  struct{ A, B int }
+	done   chan bool
+}
+`
+
+func TestSchema(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"models.go":      schemaSource,
+		"models_test.go": "package models_test\n",
+		"other.go":       "//go:build ignore\n\npackage other\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := ParseSchema(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := schemaOrder{ID: 1, Flags: 2, Status: 3, Next: &schemaOrder{ID: 4}, Wait: time.Second, Meta: json.RawMessage(`{}`)}
+	v.Items = []*schemaItem{{"a", 5}}
+	v.Where = append(v.Where, struct{ X, Y float32 }{1, 2})
+	b := encodeTest(t, v)
+	gobs, err := NewDecoder(bytes.NewReader(b), WithSchema(s), WithNaming(ContextNames)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := gobs[0].WriteTypes(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{
+		"\tID int32\n",
+		"\tFlags byte\n",
+		"\tStatus schemaStatus\n",
+		"\tNext *schemaOrder\n",
+		"\tWait tm.Duration\n",
+		"\tItems []*schemaItem\n",
+		"\tMeta json.RawMessage\n",
+		"\tTags schemaStatuses\n",
+		"\tQty uint16\n",
+		"\tWhere []schemaPoint\n",
+		"\tOther struct{A, B int}\n",
+		// these don't match
+		"\tSize [2]int64\n",
+		"\tCount int64\n",
+	} {
+		if !strings.Contains(out.String(), field) {
+			t.Errorf("expected the types to have %q got\n%s", field, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "type schemaPoint struct") {
+		t.Errorf("expected the anonymous struct to be named after the Schema's got\n%s", out.String())
+	}
+	expected := "Meta: json.RawMessage(`{}`)"
+	if line := gobs[0].Value.Display(SingleLine); !strings.Contains(line, expected) {
+		t.Errorf("expected %s in\n%s", expected, line)
+	}
+
+	var src bytes.Buffer
+	if err := WriteSource(&src, "models", gobs...); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "models.go", src.Bytes(), 0)
+	if err != nil {
+		t.Fatal(err, src.String())
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("models", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("the source doesn't compile: %v\n%s", err, src.String())
+	}
+	for _, s := range []string{`import tm "time"`, "type schemaStatus uint8"} {
+		if !strings.Contains(src.String(), s) {
+			t.Errorf("expected the source to have %q got\n%s", s, src.String())
+		}
+	}
+
+	if _, err := ParseSchema(t.TempDir()); err == nil {
+		t.Fatal("expected an error for a directory without Go files")
+	}
+}
@@ -0,0 +1,93 @@
+package degob
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// frame is a step into a type or value: a type definition, a struct field,
+// an element or an interface's concrete value
+type frame struct {
+	name  string
+	index int // -1 if it isn't an element
+}
+
+// enter and leave do nothing after an error so the frames say where it
+// happened
+func (dec *Decoder) enter(name string, index int) {
+	if dec.checkDepth(len(dec.frames) + 1) {
+		dec.frames = append(dec.frames, frame{name: name, index: index})
+	}
+}
+
+func (dec *Decoder) leave() {
+	if dec.err == nil && len(dec.frames) > 0 {
+		dec.frames = dec.frames[:len(dec.frames)-1]
+	}
+}
+
+// state is where the decoder is, like Test.W.A or def 65.Field[2]
+func (dec *Decoder) state() string {
+	var b strings.Builder
+	for _, f := range dec.frames {
+		if f.name != "" {
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(f.name)
+		}
+		if f.index >= 0 {
+			b.WriteString("[" + strconv.Itoa(f.index) + "]")
+		}
+	}
+	return b.String()
+}
+
+// WithTrace makes the Decoder write a line to w for everything it reads, as
+// it reads it: the offset in the stream, the raw bytes, what they were
+// decoded as and where in the types or values the decoder is. Unlike
+// WriteHexdump it works on gobs that fail to decode since everything up to
+// the error is already written.
+//
+//	00000000  2b                           msg len 43
+//	00000001  ff 81                        type id -65 def
+//	00000003  03                           field delta +3 → wireType.StructT         def 65
+//	...
+//	0000006f  01                           field delta +1 → Test.X                   Test
+//	00000070  13                           int -10                                   Test.X
+//
+// Errors writing to w are ignored.
+func WithTrace(w io.Writer) Option {
+	return func(dec *Decoder) {
+		dec.trace = w
+	}
+}
+
+// Trace is WithTrace for everything decoded after it is called. A nil
+// Writer turns tracing off.
+func (dec *Decoder) Trace(w io.Writer) {
+	dec.trace = w
+}
+
+// only the start of long byte ranges is written
+const traceBytes = 8
+
+func (dec *Decoder) writeTrace(s Span) {
+	b := dec.raw[s.Offset : s.Offset+s.Len]
+	more := len(b) > traceBytes
+	if more {
+		b = b[:traceBytes]
+	}
+	hex := make([]string, len(b), len(b)+1)
+	for i, c := range b {
+		hex[i] = fmt.Sprintf("%02x", c)
+	}
+	if more {
+		hex = append(hex, "...")
+	}
+	line := fmt.Sprintf("%08x  %-*s  %-40s  %s",
+		dec.gobOffset+int64(s.Offset), traceBytes*3+3, strings.Join(hex, " "), s.Label, dec.state())
+	_, _ = io.WriteString(dec.trace, strings.TrimRight(line, " ")+"\n")
+}
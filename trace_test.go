@@ -0,0 +1,47 @@
+package degob
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var buf bytes.Buffer
+	fileToBufferTest("interfacemap.bin", &buf, t)
+	var out bytes.Buffer
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()[:150]))
+	dec.Trace(&out)
+	if _, err := dec.Decode(); err == nil {
+		t.Fatal("expected an error for a truncated gob")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for _, s := range []string{
+		"00000000  0e                           msg len 14",
+		"00000003  04                           field delta +4 → wireType.MapT            def 65",
+		"end of wireType                           map[interface{}]interface{}[1].(ArrayInner).def 66",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, out.String())
+		}
+	}
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "00000094  24") {
+		t.Errorf("expected the trace to stop at the interface name that was cut off but it ended with %q", last)
+	}
+
+	out.Reset()
+	f := openFileTest("nestedstructfull.bin", t)
+	defer f.Close()
+	if _, err := NewDecoder(f, WithTrace(&out)).Decode(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"field delta +1 → Test.X                   Test\n",
+		"00000070  13                           int -10                                   Test.X\n",
+		"f8 1f 85 eb 51 b8 1e 09 ...  float 3.14                                Test.W.A\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, out.String())
+		}
+	}
+}
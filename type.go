@@ -16,6 +16,96 @@ type WireType struct {
 	GobEncoderT      *GobEncoderType
 	BinaryMarshalerT *BinaryMarshalerType
 	TextMarshalerT   *TextMarshalerType
+
+	// the types that the types this one refers to are resolved in: a
+	// Gob's or TypeTable's own copies, or the Decoder's while it decodes
+	types map[TypeID]*WireType
+}
+
+// Kind returns Struct, Slice, Array or Map for those types and Opaque for
+// GobEncoder, BinaryMarshaler and TextMarshaler types. An empty WireType
+// is Invalid.
+func (w *WireType) Kind() Kind {
+	switch {
+	case w.StructT != nil:
+		return Struct
+	case w.SliceT != nil:
+		return Slice
+	case w.ArrayT != nil:
+		return Array
+	case w.MapT != nil:
+		return Map
+	case w.GobEncoderT != nil, w.BinaryMarshalerT != nil, w.TextMarshalerT != nil:
+		return Opaque
+	default:
+		return Invalid
+	}
+}
+
+// Common returns the CommonType of whichever type is set or nil for an
+// empty WireType
+func (w *WireType) Common() *CommonType {
+	switch {
+	case w.StructT != nil:
+		return &w.StructT.CommonType
+	case w.SliceT != nil:
+		return &w.SliceT.CommonType
+	case w.ArrayT != nil:
+		return &w.ArrayT.CommonType
+	case w.MapT != nil:
+		return &w.MapT.CommonType
+	case w.GobEncoderT != nil:
+		return &w.GobEncoderT.CommonType
+	case w.BinaryMarshalerT != nil:
+		return &w.BinaryMarshalerT.CommonType
+	case w.TextMarshalerT != nil:
+		return &w.TextMarshalerT.CommonType
+	default:
+		return nil
+	}
+}
+
+// Elem returns the element type of an array, slice or map. The returned
+// WireType is nil if the element is a builtin or it couldn't be found.
+func (w *WireType) Elem() (TypeID, *WireType) {
+	var id TypeID
+	switch {
+	case w.SliceT != nil:
+		id = w.SliceT.Elem
+	case w.ArrayT != nil:
+		id = w.ArrayT.Elem
+	case w.MapT != nil:
+		id = w.MapT.Elem
+	default:
+		return 0, nil
+	}
+	return id, w.resolve(id)
+}
+
+// Key returns the key type of a map. The returned WireType is nil if the
+// key is a builtin or it couldn't be found.
+func (w *WireType) Key() (TypeID, *WireType) {
+	if w.MapT == nil {
+		return 0, nil
+	}
+	return w.MapT.Key, w.resolve(w.MapT.Key)
+}
+
+// FieldType returns the type of the i'th field of a struct. The returned
+// WireType is nil if the field is a builtin or it couldn't be found.
+func (w *WireType) FieldType(i int) (TypeID, *WireType) {
+	if w.StructT == nil || i < 0 || i >= len(w.StructT.Field) {
+		return 0, nil
+	}
+	id := w.StructT.Field[i].Id
+	return id, w.resolve(id)
+}
+
+func (w *WireType) resolve(id TypeID) *WireType {
+	if id.IsBuiltin() {
+		return nil
+	}
+	return w.types[id]
 }
 
 type GobEncoderType struct {
@@ -33,7 +123,7 @@ type TextMarshalerType struct {
 // ArrayType represents a fixed size array
 type ArrayType struct {
 	CommonType
-	Elem           typeId
+	Elem           TypeID
 	ElemTypeString string
 	Len            int
 }
@@ -41,73 +131,94 @@ type ArrayType struct {
 // CommonType has information common to all base types
 type CommonType struct {
 	Name string
-	Id   int
+	Id   TypeID
 }
 
 // SliceType represents a slice
 type SliceType struct {
 	CommonType
-	Elem           typeId
+	Elem           TypeID
 	ElemTypeString string
 }
 type StructType struct {
 	CommonType
 	Field []*FieldType
+
+	anonymous bool // the name was made up by us
 }
 
 // FieldType is the information for a struct field
 type FieldType struct {
 	Name       string
 	TypeString string
-	Id         int
+	Id         TypeID
+	// Comment is printed after the field, a Corpus uses it to explain a
+	// narrower TypeString
+	Comment string
+
+	wireName string  // the name it is sent with if Hints renamed it
+	hint     *goType // the type Hints or a Schema gave it
+}
+
+// goType is a Go type for a field and what has to be in a file that uses it
+type goType struct {
+	expr string
+	// like "time" or tm "time"
+	imports []string
+	// declarations of the types from a Schema that it refers to, by name
+	decls map[string]string
 }
 
 // MapType is the information for a map
 type MapType struct {
 	CommonType
-	Key            typeId
+	Key            TypeID
 	KeyTypeString  string
-	Elem           typeId
+	Elem           TypeID
 	ElemTypeString string
 }
 
+// TypeID identifies a type in a gob. IDs 1 to 8 are the builtin types, 9
+// to 15 are reserved and user defined types start at 65.
+type TypeID int32
+
+// The builtin types
 const (
-	// builtin types
-	_bool_id      typeId = 1
-	_int_id       typeId = 2
-	_uint_id      typeId = 3
-	_float_id     typeId = 4
-	_bytes_id     typeId = 5
-	_string_id    typeId = 6
-	_complex_id   typeId = 7
-	_interface_id typeId = 8
+	BoolID      TypeID = 1
+	IntID       TypeID = 2
+	UintID      TypeID = 3
+	FloatID     TypeID = 4
+	BytesID     TypeID = 5
+	StringID    TypeID = 6
+	ComplexID   TypeID = 7
+	InterfaceID TypeID = 8
 	// reserved types
-	_reserved1_id typeId = 9
-	_reserved2_id typeId = 10
-	_reserved3_id typeId = 11
-	_reserved4_id typeId = 12
-	_reserved5_id typeId = 13
-	_reserved6_id typeId = 14
-	_reserved7_id typeId = 15
+	_reserved1_id TypeID = 9
+	_reserved2_id TypeID = 10
+	_reserved3_id TypeID = 11
+	_reserved4_id TypeID = 12
+	_reserved5_id TypeID = 13
+	_reserved6_id TypeID = 14
+	_reserved7_id TypeID = 15
 )
 
-func (t typeId) String() string {
+func (t TypeID) String() string {
 	switch t {
-	case _bool_id:
+	case BoolID:
 		return "1 (bool)"
-	case _int_id:
+	case IntID:
 		return "2 (int)"
-	case _uint_id:
+	case UintID:
 		return "3 (uint)"
-	case _float_id:
+	case FloatID:
 		return "4 (float)"
-	case _bytes_id:
+	case BytesID:
 		return "5 (bytes)"
-	case _string_id:
+	case StringID:
 		return "6 (string)"
-	case _complex_id:
+	case ComplexID:
 		return "7 (complex)"
-	case _interface_id:
+	case InterfaceID:
 		return "8 (interface)"
 	case _reserved1_id:
 		return "9 (reserved)"
@@ -129,15 +240,19 @@ func (t typeId) String() string {
 }
 
 // Value is a reprsentation of a Go value. You can test for equality and
-// Display them stylized
+// Display them stylized. Use Kind to find out which of the exported value
+// interfaces (StructValue, SliceValue, IntValue...) it can be asserted to.
 type Value interface {
 	// Equal tests for equality to another value
 	Equal(Value) bool
 	// Display shows the value accoring to the chosen style
 	Display(sty style) string
+	// Kind is the kind of Go value this is
+	Kind() Kind
 }
 
 type sliceValue struct {
+	id       TypeID
 	elemType string
 	values   []Value
 }
@@ -162,6 +277,7 @@ func (v sliceValue) Equal(o Value) bool {
 }
 
 type arrayValue struct {
+	id       TypeID
 	elemType string
 	length   int
 	values   []Value
@@ -193,9 +309,11 @@ type mapEntry struct {
 }
 
 type mapValue struct {
+	id       TypeID
 	keyType  string
 	elemType string
 	values   []mapEntry
+	sent     bool // it was sent, so it isn't nil even if it's empty
 }
 
 func (v mapValue) Equal(o Value) bool {
@@ -233,8 +351,10 @@ func (v mapValue) Equal(o Value) bool {
 }
 
 type opaqueEncodedValue struct {
-	name  string
-	value _bytes_type
+	id      TypeID
+	name    string
+	value   _bytes_type
+	decoded DecodedOpaque // set if an OpaqueDecoder understood value
 }
 
 func (oev *opaqueEncodedValue) Equal(o Value) bool {
@@ -248,6 +368,7 @@ func (oev *opaqueEncodedValue) Equal(o Value) bool {
 type structField struct {
 	name  string
 	value Value
+	typ   string // the type Hints or a Schema gave the field
 }
 
 type structFields []structField
@@ -257,8 +378,8 @@ func (s structFields) Less(i, j int) bool { return s[i].name < s[j].name }
 func (s structFields) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 type structValue struct {
+	id     TypeID
 	name   string
-	sorted bool
 	fields structFields
 }
 
@@ -276,18 +397,13 @@ func (s *structValue) Equal(o Value) bool {
 		return false
 	}
 
-	if !s.sorted {
-		sort.Sort(s.fields)
-		s.sorted = true
-	}
-	if !v.sorted {
-		sort.Sort(v.fields)
-		v.sorted = true
-	}
+	// compare sorted copies so the fields stay in wire order
+	sfields := s.sortedFields()
+	vfields := v.sortedFields()
 
-	for fno := range s.fields {
-		sf := s.fields[fno]
-		vf := v.fields[fno]
+	for fno := range sfields {
+		sf := sfields[fno]
+		vf := vfields[fno]
 		if sf.name != vf.name {
 			return false
 		}
@@ -298,6 +414,13 @@ func (s *structValue) Equal(o Value) bool {
 	return true
 }
 
+func (s *structValue) sortedFields() structFields {
+	fields := make(structFields, len(s.fields))
+	copy(fields, s.fields)
+	sort.Sort(fields)
+	return fields
+}
+
 type _bool_type bool
 
 func (v _bool_type) Equal(o Value) bool {
@@ -384,9 +507,17 @@ func (v _nil_value) Equal(o Value) bool {
 	return ok
 }
 
+type _unread_value struct{}
+
+func (v _unread_value) Equal(o Value) bool {
+	_, ok := o.(_unread_value)
+	return ok
+}
+
 type interfaceValue struct {
-	name  string
-	value Value
+	name       string
+	registered string // the full name the concrete type was registered with
+	value      Value
 }
 
 func (v interfaceValue) Equal(o Value) bool {
@@ -400,59 +531,65 @@ func (v interfaceValue) Equal(o Value) bool {
 	return v.value.Equal(ov.value)
 }
 
-func valueFor(id typeId) Value {
+func valueFor(id TypeID) Value {
 	switch id {
-	case _bool_id:
+	case BoolID:
 		var v _bool_type
 		return v
-	case _int_id:
+	case IntID:
 		var v _int_type
 		return v
-	case _uint_id:
+	case UintID:
 		var v _uint_type
 		return v
-	case _float_id:
+	case FloatID:
 		var v _float_type
 		return v
-	case _bytes_id:
+	case BytesID:
 		var v _bytes_type
 		return v
-	case _string_id:
+	case StringID:
 		var v _string_type
 		return v
-	case _complex_id:
+	case ComplexID:
 		var v _complex_type
 		return v
-	case _interface_id:
+	case InterfaceID:
 		return interfaceValue{value: _nil_value{}}
 	default:
-		panic("unknown id")
+		return _unread_value{}
 	}
 }
 
-func isBuiltin(id typeId) bool {
+func isBuiltin(id TypeID) bool {
 	return (id >= 1) && (id <= 8)
 }
 
-func (t typeId) name() string {
+// IsBuiltin reports whether this is one of the builtin types that don't have
+// a WireType
+func (t TypeID) IsBuiltin() bool {
+	return isBuiltin(t)
+}
+
+func (t TypeID) name() string {
 	switch t {
-	case _bool_id:
+	case BoolID:
 		return "bool"
-	case _int_id:
+	case IntID:
 		return "int64"
-	case _uint_id:
+	case UintID:
 		return "uint64"
-	case _float_id:
+	case FloatID:
 		return "float64"
-	case _bytes_id:
+	case BytesID:
 		return "[]byte"
-	case _string_id:
+	case StringID:
 		return "string"
-	case _complex_id:
+	case ComplexID:
 		return "complex128"
-	case _interface_id:
+	case InterfaceID:
 		return "interface{}"
 	default:
-		panic("unknown id")
+		return fmt.Sprintf("Undefined%d", t)
 	}
 }
@@ -16,16 +16,14 @@ func testNotEqual(v Value, notEq Value, t *testing.T) {
 
 func TestEqualStructValue(t *testing.T) {
 	v := structValue{
-		name:   "TestStructValue",
-		sorted: true,
+		name: "TestStructValue",
 		fields: structFields{
 			structField{name: "Bar", value: _int_type(10)},
 			structField{name: "Foo", value: _string_type("foo")},
 		},
 	}
 	eq := structValue{
-		name:   "TestStructValue",
-		sorted: true,
+		name: "TestStructValue",
 		fields: structFields{
 			structField{name: "Bar", value: _int_type(10)},
 			structField{name: "Foo", value: _string_type("foo")},
@@ -35,8 +33,7 @@ func TestEqualStructValue(t *testing.T) {
 	testEqual(&v, &eq, t)
 
 	notEqName := structValue{
-		name:   "NotEqualName",
-		sorted: true,
+		name: "NotEqualName",
 		fields: structFields{
 			structField{name: "Bar", value: _int_type(10)},
 			structField{name: "Foo", value: _string_type("foo")},
@@ -46,8 +43,7 @@ func TestEqualStructValue(t *testing.T) {
 	testNotEqual(&v, &notEqName, t)
 
 	notEqFieldName := structValue{
-		name:   "TestStructValue",
-		sorted: true,
+		name: "TestStructValue",
 		fields: structFields{
 			structField{name: "Baz", value: _int_type(10)},
 			structField{name: "Foo", value: _string_type("foo")},
@@ -57,8 +53,7 @@ func TestEqualStructValue(t *testing.T) {
 	testNotEqual(&v, &notEqFieldName, t)
 
 	notEqFieldValue := structValue{
-		name:   "TestStructValue",
-		sorted: true,
+		name: "TestStructValue",
 		fields: structFields{
 			structField{name: "Bar", value: _int_type(20)},
 			structField{name: "Foo", value: _string_type("foo")},
@@ -68,8 +63,7 @@ func TestEqualStructValue(t *testing.T) {
 	testNotEqual(&v, &notEqFieldValue, t)
 
 	notEqFieldNum := structValue{
-		name:   "TestStructValue",
-		sorted: true,
+		name: "TestStructValue",
 		fields: structFields{
 			structField{name: "Bar", value: _int_type(20)},
 		},
@@ -408,3 +402,55 @@ func TestEqualSliceValue(t *testing.T) {
 	testNotEqual(&v, &notEqElemTypeString, t)
 	testNotEqual(&v, _complex_type(1), t)
 }
+
+func TestWireTypeGraph(t *testing.T) {
+	g := decodeFileTest("nestedstructfull.bin", t)[0]
+	var test *WireType
+	for _, w := range g.Types {
+		if w.Common().Name == "Test" {
+			test = w
+		}
+	}
+	if test == nil || test.Kind() != Struct {
+		t.Fatal("didn't find the Test struct")
+	}
+	id, inner := test.FieldType(0)
+	if inner == nil || inner.Common().Name != "Inner" || g.Types[id] != inner {
+		t.Fatalf("field W should resolve to Inner but was %v", id)
+	}
+	id, w := test.FieldType(1)
+	if id != IntID || !id.IsBuiltin() || w != nil {
+		t.Fatalf("field X should be a builtin int but was %v", id)
+	}
+	if id, w := test.FieldType(10); id != 0 || w != nil {
+		t.Fatal("out of range field should be empty")
+	}
+
+	g = decodeFileTest("slicestruct.bin", t)[0]
+	for _, w := range g.Types {
+		if w.Kind() != Slice {
+			continue
+		}
+		_, elem := w.Elem()
+		if elem == nil || elem.Kind() != Struct {
+			t.Fatalf("slice element should resolve to a struct")
+		}
+		if id, _ := w.Key(); id != 0 {
+			t.Fatal("slices don't have keys")
+		}
+	}
+
+	g = decodeFileTest("mapuserdefined.bin", t)[0]
+	for _, w := range g.Types {
+		if w.Kind() != Map {
+			continue
+		}
+		key, kw := w.Key()
+		if !key.IsBuiltin() || kw != nil {
+			t.Fatalf("expected builtin key but got %v", key)
+		}
+		if _, elem := w.Elem(); elem == nil {
+			t.Fatal("map element should resolve to a struct")
+		}
+	}
+}
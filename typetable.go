@@ -0,0 +1,122 @@
+package degob
+
+import (
+	"io"
+	"sort"
+)
+
+// TypeTable is every type an encoder has sent keyed by the ID it was sent
+// with. A gob.Encoder only sends each type once, at the start of the
+// connection, so a capture that starts later can't be decoded without the
+// table from one that didn't.
+type TypeTable map[TypeID]*WireType
+
+// Types returns copies of the types defined so far in the current encoder
+// session, which refer to each other and not to the Decoder's
+func (dec *Decoder) Types() TypeTable {
+	t := make(TypeTable, len(dec.seenTypes))
+	copyTypes(t, dec.seenTypes)
+	return t
+}
+
+// WithTypes starts the Decoder off knowing the types in t, as if it had
+// already read their definitions. If the input defines one of them again
+// at the start of a gob it is from a new encoder and t is forgotten.
+func WithTypes(t TypeTable) Option {
+	return func(dec *Decoder) {
+		dec.resetTypes()
+		for id, w := range t {
+			// the copy resolves what it refers to in this Decoder and
+			// can be renamed without changing t
+			c := w.copy()
+			c.types = dec.seenTypes
+			dec.seenTypes[id] = c
+			dec.pending = append(dec.pending, id)
+		}
+		dec.tableTypes = len(t) > 0
+	}
+}
+
+// copy copies w and the type in it
+func (w *WireType) copy() *WireType {
+	c := *w
+	switch {
+	case w.ArrayT != nil:
+		t := *w.ArrayT
+		c.ArrayT = &t
+	case w.SliceT != nil:
+		t := *w.SliceT
+		c.SliceT = &t
+	case w.MapT != nil:
+		t := *w.MapT
+		c.MapT = &t
+	case w.GobEncoderT != nil:
+		t := *w.GobEncoderT
+		c.GobEncoderT = &t
+	case w.BinaryMarshalerT != nil:
+		t := *w.BinaryMarshalerT
+		c.BinaryMarshalerT = &t
+	case w.TextMarshalerT != nil:
+		t := *w.TextMarshalerT
+		c.TextMarshalerT = &t
+	case w.StructT != nil:
+		t := *w.StructT
+		t.Field = make([]*FieldType, len(w.StructT.Field))
+		for i, f := range w.StructT.Field {
+			fc := *f
+			t.Field[i] = &fc
+		}
+		c.StructT = &t
+	}
+	return &c
+}
+
+// copyTypes puts copies of the types in from into to that refer to the
+// ones in to
+func copyTypes(to, from map[TypeID]*WireType) {
+	for id, w := range from {
+		c := w.copy()
+		c.types = to
+		to[id] = c
+	}
+}
+
+// Encode writes t as the messages defining its types, with their IDs, the
+// way a gob.Encoder would send them. ReadTypeTable reads them back, and
+// since they are a gob stream with no values they can also go in front of
+// a capture that is missing them. Types that t refers to but doesn't have,
+// because the capture it came from was cut short, are referred to by their
+// IDs for whatever defines them later.
+func (t TypeTable) Encode(w io.Writer) error {
+	ids := make([]TypeID, 0, len(t))
+	for id := range t {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	enc := NewEncoder(w)
+	enc.types = t
+	enc.partial = true
+	for _, id := range ids {
+		enc.pending = enc.pending[:0]
+		if _, err := enc.typeID(id, nil); err != nil {
+			return err
+		}
+		for _, def := range enc.pending {
+			if err := enc.writeMessage(def); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadTypeTable returns the types defined in r, which can be a table
+// written by Encode or any gob stream like a capture from the start of a
+// connection. Values are decoded and thrown away. If r has more than one
+// encoder session it is the types of the last one. After an error, like a
+// capture that was cut short, the types read before it are still returned.
+func ReadTypeTable(r io.Reader) (TypeTable, error) {
+	dec := NewDecoder(r)
+	err := dec.DecodeHandler(BaseHandler{})
+	return dec.Types(), err
+}
@@ -0,0 +1,109 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+)
+
+func TestTypeTable(t *testing.T) {
+	type Item struct {
+		Name string
+		Qty  uint
+	}
+	type Order struct {
+		ID    int
+		Items []Item
+		Tags  map[string]string
+	}
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(Order{ID: 1, Items: []Item{{"a", 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	// a capture from after the types were sent
+	start := buf.Len()
+	if err := enc.Encode(Order{ID: 2, Items: []Item{{"b", 2}, {"c", 3}}, Tags: map[string]string{"k": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	later := b[start:]
+	expected, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = expected[1:]
+
+	if _, err := NewDecoder(bytes.NewReader(later)).Decode(); !errors.Is(err, errUnknownType) {
+		t.Fatal("expected an unknown type without the table got", err)
+	}
+	table, err := ReadTypeTable(bytes.NewReader(b[:start]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 4 {
+		t.Fatalf("expected 4 types got %d", len(table))
+	}
+	for _, w := range table {
+		if id, elem := w.Elem(); elem != nil && table[id] != elem {
+			t.Fatalf("expected %v to resolve to the table's type", id)
+		}
+	}
+	got, err := NewDecoder(bytes.NewReader(later), WithTypes(table)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDisplay(t, expected, got)
+
+	// saved and loaded again
+	var saved bytes.Buffer
+	if err := table.Encode(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadTypeTable(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = NewDecoder(bytes.NewReader(later), WithTypes(loaded)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDisplay(t, expected, got)
+	// and in front of the capture
+	got, err = NewDecoder(bytes.NewReader(append(saved.Bytes(), later...))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDisplay(t, expected, got)
+
+	// the whole stream defines the types again so the table is dropped
+	got, err = NewDecoder(bytes.NewReader(b), WithTypes(table)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDisplay(t, expected, got[1:])
+
+	// a capture that was cut short still has its types
+	cut, err := ReadTypeTable(bytes.NewReader(b[:start-1]))
+	if err == nil || len(cut) != 4 {
+		t.Fatalf("expected 4 types and an error got %d and %v", len(cut), err)
+	}
+
+	// or only some of them, which can still be saved
+	part, _ := ReadTypeTable(bytes.NewReader(b[:start-1]))
+	for id, w := range part {
+		if w.StructT != nil && w.StructT.Name == "Order" {
+			c := *w
+			c.types = nil
+			part = TypeTable{id: &c}
+		}
+	}
+	saved.Reset()
+	if err := part.Encode(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = ReadTypeTable(&saved); err != nil || len(loaded) != 1 {
+		t.Fatalf("expected 1 type got %d and %v", len(loaded), err)
+	}
+}
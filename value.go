@@ -0,0 +1,255 @@
+package degob
+
+// Kind is the kind of Go value held by a Value
+type Kind uint8
+
+const (
+	Invalid Kind = iota
+	Bool
+	Int
+	Uint
+	Float
+	Complex
+	Bytes
+	String
+	Interface
+	Nil
+	Struct
+	Slice
+	Array
+	Map
+	// Opaque values come from GobEncoder, BinaryMarshaler and TextMarshaler
+	// types which encode themselves however they like
+	Opaque
+	// Unread values stand in for the parts of a value that weren't read
+	// because decoding it failed. See DecodeLenient.
+	Unread
+)
+
+var kindNames = [...]string{
+	Invalid:   "invalid",
+	Bool:      "bool",
+	Int:       "int",
+	Uint:      "uint",
+	Float:     "float",
+	Complex:   "complex",
+	Bytes:     "bytes",
+	String:    "string",
+	Interface: "interface",
+	Nil:       "nil",
+	Struct:    "struct",
+	Slice:     "slice",
+	Array:     "array",
+	Map:       "map",
+	Opaque:    "opaque",
+	Unread:    "unread",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "invalid"
+}
+
+// Field is a single struct field
+type Field struct {
+	Name  string
+	Value Value
+}
+
+// MapEntry is a single key/value pair in a map
+type MapEntry struct {
+	Key  Value
+	Elem Value
+}
+
+// StructValue is a Value of kind Struct
+type StructValue interface {
+	Value
+	// Name is the name of the struct type
+	Name() string
+	// Fields returns the fields in the order they are defined on the wire
+	Fields() []Field
+	// Field returns the value of the named field
+	Field(name string) (Value, bool)
+}
+
+// SliceValue is a Value of kind Slice
+type SliceValue interface {
+	Value
+	// ElemType is the type name of the elements
+	ElemType() string
+	Len() int
+	Index(i int) Value
+}
+
+// ArrayValue is a Value of kind Array
+type ArrayValue interface {
+	Value
+	// ElemType is the type name of the elements
+	ElemType() string
+	Len() int
+	Index(i int) Value
+}
+
+// MapValue is a Value of kind Map
+type MapValue interface {
+	Value
+	KeyType() string
+	ElemType() string
+	Len() int
+	// Entries returns the entries in the order they were on the wire
+	Entries() []MapEntry
+}
+
+// InterfaceValue is a Value of kind Interface
+type InterfaceValue interface {
+	Value
+	// Name is the name of the concrete type or "" for a nil interface
+	Name() string
+	// RegisteredName is the full name the concrete type was registered with
+	// using gob.Register
+	RegisteredName() string
+	// Elem is the concrete value. It is of kind Nil for a nil interface.
+	Elem() Value
+}
+
+// OpaqueValue is a Value of kind Opaque
+type OpaqueValue interface {
+	Value
+	// Name is the name of the type that encoded itself
+	Name() string
+	// Bytes are the raw bytes it encoded itself to
+	Bytes() []byte
+	// Decoded is what the OpaqueDecoder registered for the type's name made
+	// of the bytes or nil if there isn't one or it didn't understand them
+	Decoded() DecodedOpaque
+}
+
+// BoolValue is a Value of kind Bool
+type BoolValue interface {
+	Value
+	Bool() bool
+}
+
+// IntValue is a Value of kind Int
+type IntValue interface {
+	Value
+	Int() int64
+}
+
+// UintValue is a Value of kind Uint
+type UintValue interface {
+	Value
+	Uint() uint64
+}
+
+// FloatValue is a Value of kind Float
+type FloatValue interface {
+	Value
+	Float() float64
+}
+
+// ComplexValue is a Value of kind Complex
+type ComplexValue interface {
+	Value
+	Complex() complex128
+}
+
+// BytesValue is a Value of kind Bytes
+type BytesValue interface {
+	Value
+	Bytes() []byte
+}
+
+// StringValue is a Value of kind String
+type StringValue interface {
+	Value
+	String() string
+}
+
+func (s *structValue) Kind() Kind   { return Struct }
+func (s *structValue) Name() string { return s.name }
+
+func (s *structValue) Fields() []Field {
+	fields := make([]Field, len(s.fields))
+	for i, f := range s.fields {
+		fields[i] = Field{Name: f.name, Value: f.value}
+	}
+	return fields
+}
+
+func (s *structValue) Field(name string) (Value, bool) {
+	for _, f := range s.fields {
+		if f.name == name {
+			return f.value, true
+		}
+	}
+	return nil, false
+}
+
+func (v sliceValue) Kind() Kind        { return Slice }
+func (v sliceValue) ElemType() string  { return v.elemType }
+func (v sliceValue) Len() int          { return len(v.values) }
+func (v sliceValue) Index(i int) Value { return v.values[i] }
+
+func (v arrayValue) Kind() Kind        { return Array }
+func (v arrayValue) ElemType() string  { return v.elemType }
+func (v arrayValue) Len() int          { return len(v.values) }
+func (v arrayValue) Index(i int) Value { return v.values[i] }
+
+func (v mapValue) Kind() Kind       { return Map }
+func (v mapValue) KeyType() string  { return v.keyType }
+func (v mapValue) ElemType() string { return v.elemType }
+func (v mapValue) Len() int         { return len(v.values) }
+
+func (v mapValue) Entries() []MapEntry {
+	entries := make([]MapEntry, len(v.values))
+	for i, e := range v.values {
+		entries[i] = MapEntry{Key: e.key, Elem: e.elem}
+	}
+	return entries
+}
+
+func (v interfaceValue) Kind() Kind   { return Interface }
+func (v interfaceValue) Name() string { return v.name }
+func (v interfaceValue) Elem() Value  { return v.value }
+
+func (v interfaceValue) RegisteredName() string {
+	if v.registered == "" {
+		return v.name
+	}
+	return v.registered
+}
+
+func (oev *opaqueEncodedValue) Kind() Kind    { return Opaque }
+func (oev *opaqueEncodedValue) Name() string  { return oev.name }
+func (oev *opaqueEncodedValue) Bytes() []byte { return []byte(oev.value) }
+
+func (oev *opaqueEncodedValue) Decoded() DecodedOpaque { return oev.decoded }
+
+func (v _bool_type) Kind() Kind { return Bool }
+func (v _bool_type) Bool() bool { return bool(v) }
+
+func (v _int_type) Kind() Kind { return Int }
+func (v _int_type) Int() int64 { return int64(v) }
+
+func (v _uint_type) Kind() Kind   { return Uint }
+func (v _uint_type) Uint() uint64 { return uint64(v) }
+
+func (v _float_type) Kind() Kind     { return Float }
+func (v _float_type) Float() float64 { return float64(v) }
+
+func (v _complex_type) Kind() Kind          { return Complex }
+func (v _complex_type) Complex() complex128 { return complex128(v) }
+
+func (v _bytes_type) Kind() Kind    { return Bytes }
+func (v _bytes_type) Bytes() []byte { return []byte(v) }
+
+func (v _string_type) Kind() Kind     { return String }
+func (v _string_type) String() string { return string(v) }
+
+func (v _nil_value) Kind() Kind { return Nil }
+
+func (v _unread_value) Kind() Kind { return Unread }
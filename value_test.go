@@ -0,0 +1,100 @@
+package degob
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func decodeFileTest(fname string, t *testing.T) []*Gob {
+	var buf bytes.Buffer
+	fileToBufferTest(fname, &buf, t)
+	gobs, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatalf("err: %v decoding gob in file: %s", err, fname)
+	}
+	return gobs
+}
+
+func TestStructValueAccessors(t *testing.T) {
+	g := decodeFileTest("nestedstructfull.bin", t)[0]
+	if g.Kind() != Struct {
+		t.Fatalf("expected kind struct but got %s", g.Kind())
+	}
+	s := g.Value.(StructValue)
+	cmp(s.Name(), "Test", t)
+	// Equal used to sort the fields in place
+	if !g.Value.Equal(g.Value) {
+		t.Fatal("value should equal itself")
+	}
+	var names []string
+	for _, f := range s.Fields() {
+		names = append(names, f.Name)
+	}
+	cmp(strings.Join(names, " "), "W X Y Z", t)
+
+	x, ok := s.Field("X")
+	if !ok || x.(IntValue).Int() != -10 {
+		t.Fatalf("expected X to be -10 but got %v", x)
+	}
+	w, _ := s.Field("W")
+	c, _ := w.(StructValue).Field("C")
+	if !bytes.Equal(c.(BytesValue).Bytes(), []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("unexpected W.C %v", c)
+	}
+	z, _ := s.Field("Z")
+	if z.Kind() != String || z.(StringValue).String() != "Hello" {
+		t.Fatalf("unexpected Z %v", z)
+	}
+	if _, ok := s.Field("Nope"); ok {
+		t.Fatal("found a field that doesn't exist")
+	}
+}
+
+func TestContainerValueAccessors(t *testing.T) {
+	g := decodeFileTest("interfacemap.bin", t)[0]
+	m, ok := g.Value.(MapValue)
+	if !ok {
+		t.Fatalf("expected a map but got %s", g.Kind())
+	}
+	cmp(m.KeyType(), "interface{}", t)
+	if m.Len() != 4 || len(m.Entries()) != 4 {
+		t.Fatalf("expected 4 entries but got %d", m.Len())
+	}
+	found := false
+	for _, e := range m.Entries() {
+		k := e.Key.(InterfaceValue)
+		if k.Name() != "ArrayInner" {
+			continue
+		}
+		found = true
+		f, _ := k.Elem().(StructValue).Field("Float")
+		if f.(FloatValue).Float() != 1.2 {
+			t.Fatalf("unexpected key %s", k.Display(SingleLine))
+		}
+		elem := e.Elem.(InterfaceValue).Elem().(StructValue)
+		b, _ := elem.Field("Byte")
+		if b.(UintValue).Uint() != 4 {
+			t.Fatalf("unexpected elem %s", elem.Display(SingleLine))
+		}
+	}
+	if !found {
+		t.Fatal("didn't find the struct key")
+	}
+
+	g = decodeFileTest("slicebuiltin.bin", t)[0]
+	s := g.Value.(SliceValue)
+	for i := 0; i < s.Len(); i++ {
+		if s.Index(i).Kind() != s.Index(0).Kind() {
+			t.Fatalf("mixed kinds in slice %s", s.Display(SingleLine))
+		}
+	}
+
+	g = decodeFileTest("interfaceswithnil.bin", t)[0]
+	for _, e := range g.Value.(MapValue).Entries() {
+		i := e.Elem.(InterfaceValue)
+		if i.Name() == "" && i.Elem().Kind() != Nil {
+			t.Fatalf("expected nil interface but got %s", i.Elem().Kind())
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Mismatch is a difference between what degob and `encoding/gob` decoded from
+// the same bytes. `encoding/gob` is always right so a Mismatch is a bug in
+// degob.
+type Mismatch struct {
+	// Gob is the index of the gob in the input
+	Gob int
+	// Path is the path to the value in the form Set takes
+	Path string
+	// Degob and EncodingGob are what each of them decoded. EncodingGob is
+	// the error if `encoding/gob` failed to decode the value at all.
+	Degob       string
+	EncodingGob string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("gob %d %s: degob has %s but encoding/gob has %s", m.Gob+1, m.Path, m.Degob, m.EncodingGob)
+}
+
+// Verification is the result of Verify
+type Verification struct {
+	// Checked is the number of gobs that were compared
+	Checked int
+	// Skipped has the reason each gob that couldn't be compared was skipped
+	// keyed by its index in the input
+	Skipped    map[int]error
+	Mismatches []Mismatch
+}
+
+// Verify decodes the gobs in r with degob and again with `encoding/gob` into
+// types built with reflect from the types degob found, then compares the two
+// value by value.
+//
+// reflect can't build recursive types or the methods opaque types need, so
+// struct fields of those types are left out and gobs whose values can't be
+// built at all are skipped. `encoding/gob` can only decode an interface
+// holding a type that was registered with it, which Verify won't do, so
+// gobs with those are skipped as well; VerifyRegistering checks them.
+func Verify(r io.Reader) (*Verification, error) {
+	return verify(r, false)
+}
+
+// VerifyRegistering is Verify but registers the concrete types found in
+// interfaces with `encoding/gob` under the names they were sent with so
+// those gobs can be checked too. A gob that can't be registered is skipped.
+// The registration is global and lasts for the rest of the program, so a
+// later gob.Register of a real type with one of those names panics and
+// `encoding/gob` decodes them as the built types. It is meant for tools
+// like `degob verify` that don't decode real gobs themselves.
+func VerifyRegistering(r io.Reader) (*Verification, error) {
+	return verify(r, true)
+}
+
+func verify(r io.Reader, register bool) (*Verification, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	gobs, err := NewDecoder(bytes.NewReader(raw)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	return verifyGobs(raw, gobs, register)
+}
+
+// verifyGobs compares gobs to what `encoding/gob` decodes from raw,
+// registering the types in their interfaces if register is set
+func verifyGobs(raw []byte, gobs []*Gob, register bool) (*Verification, error) {
+	ver := &verifier{
+		built:    make(map[*WireType]reflect.Type),
+		building: make(map[*WireType]bool),
+		register: register,
+	}
+	gdec := gob.NewDecoder(bytes.NewReader(raw))
+	res := &Verification{Skipped: make(map[int]error)}
+	for i, g := range gobs {
+		ver.types = g.Types
+		t, err := ver.valueType(g.Value)
+		if err == nil {
+			err = ver.registerInterfaces(g.Value)
+		}
+		if err != nil {
+			res.Skipped[i] = err
+			// still have to read past it
+			if err := gdec.DecodeValue(reflect.Value{}); err != nil {
+				return res, fmt.Errorf("gob %d: encoding/gob failed to skip it: %v", i+1, err)
+			}
+			continue
+		}
+		res.Checked++
+		rv := reflect.New(t)
+		if err := gdec.DecodeValue(rv); err != nil {
+			res.Mismatches = append(res.Mismatches, Mismatch{
+				Gob:         i,
+				Path:        ".",
+				Degob:       g.Value.Display(SingleLine),
+				EncodingGob: err.Error(),
+			})
+			continue
+		}
+		ver.gob = i
+		ver.compare(nil, g.Value, rv.Elem())
+		res.Mismatches = append(res.Mismatches, ver.mismatches...)
+		ver.mismatches = nil
+	}
+	return res, nil
+}
+
+var (
+	errRecursiveType   = errors.New("reflect can't build recursive types")
+	errOpaqueType      = errors.New("reflect can't build opaque types")
+	errNoFieldsToBuild = errors.New("none of the struct's fields could be built")
+	interfaceType      = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+type verifier struct {
+	// the type table of the gob being verified
+	types    map[TypeID]*WireType
+	built    map[*WireType]reflect.Type
+	building map[*WireType]bool
+	register bool
+
+	gob        int
+	mismatches []Mismatch
+}
+
+func (ver *verifier) valueType(v Value) (reflect.Type, error) {
+	id, err := valueTypeID(v)
+	if err != nil {
+		return nil, err
+	}
+	return ver.reflectType(id)
+}
+
+// reflectType builds the type for id
+func (ver *verifier) reflectType(id TypeID) (reflect.Type, error) {
+	switch id {
+	case BoolID:
+		return reflect.TypeOf(false), nil
+	case IntID:
+		return reflect.TypeOf(int64(0)), nil
+	case UintID:
+		return reflect.TypeOf(uint64(0)), nil
+	case FloatID:
+		return reflect.TypeOf(float64(0)), nil
+	case BytesID:
+		return reflect.TypeOf([]byte(nil)), nil
+	case StringID:
+		return reflect.TypeOf(""), nil
+	case ComplexID:
+		return reflect.TypeOf(complex128(0)), nil
+	case InterfaceID:
+		return interfaceType, nil
+	}
+	w, ok := ver.types[id]
+	if !ok {
+		return nil, fmt.Errorf("type %d isn't defined", id)
+	}
+	if t, ok := ver.built[w]; ok {
+		return t, nil
+	}
+	if ver.building[w] {
+		return nil, errRecursiveType
+	}
+	ver.building[w] = true
+	defer delete(ver.building, w)
+
+	var t reflect.Type
+	var err error
+	switch w.Kind() {
+	case Struct:
+		t, err = ver.structType(w.StructT)
+	case Slice:
+		t, err = ver.reflectType(w.SliceT.Elem)
+		if err == nil {
+			t = reflect.SliceOf(t)
+		}
+	case Array:
+		t, err = ver.reflectType(w.ArrayT.Elem)
+		if err == nil {
+			t = reflect.ArrayOf(w.ArrayT.Len, t)
+		}
+	case Map:
+		var key reflect.Type
+		key, err = ver.reflectType(w.MapT.Key)
+		if err == nil {
+			t, err = ver.reflectType(w.MapT.Elem)
+		}
+		if err == nil {
+			t = reflect.MapOf(key, t)
+		}
+	case Opaque:
+		err = errOpaqueType
+	default:
+		err = errors.New("empty WireType")
+	}
+	if err != nil {
+		return nil, err
+	}
+	ver.built[w] = t
+	return t, nil
+}
+
+// fields that can't be built are left out and `encoding/gob` skips them
+func (ver *verifier) structType(st *StructType) (reflect.Type, error) {
+	var fields []reflect.StructField
+	for _, f := range st.Field {
+		t, err := ver.reflectType(f.Id)
+		if err == errRecursiveType || err == errOpaqueType || err == errNoFieldsToBuild {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// encoding/gob needs the name the field was sent with and the
+		// tag has the one in the Value
+		fields = append(fields, reflect.StructField{
+			Name: f.wire(),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf("degob:%q", f.Name)),
+		})
+	}
+	if len(fields) == 0 && len(st.Field) > 0 {
+		return nil, errNoFieldsToBuild
+	}
+	return reflect.StructOf(fields), nil
+}
+
+// registerInterfaces registers the concrete types of all of the interfaces
+// in v with `encoding/gob`, or fails if the verifier doesn't register
+func (ver *verifier) registerInterfaces(v Value) error {
+	var err error
+	walkValues(v, func(v Value) bool {
+		iv, ok := v.(InterfaceValue)
+		if !ok || err != nil {
+			return err == nil
+		}
+		elem := iv.Elem()
+		name := iv.RegisteredName()
+		// encoding/gob registers the builtin types itself
+		if elem == nil || elem.Kind() == Nil || !strings.Contains(name, ".") {
+			return true
+		}
+		if !ver.register {
+			err = fmt.Errorf("%s would have to be registered with encoding/gob", name)
+			return false
+		}
+		var t reflect.Type
+		t, err = ver.valueType(elem)
+		if err != nil {
+			return false
+		}
+		err = registerName(name, t)
+		return err == nil
+	})
+	return err
+}
+
+func registerName(name string, t reflect.Type) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("can't register %s: %v", name, r)
+		}
+	}()
+	if strings.HasPrefix(name, "*") {
+		gob.RegisterName(name, reflect.New(t).Interface())
+	} else {
+		gob.RegisterName(name, reflect.New(t).Elem().Interface())
+	}
+	return nil
+}
+
+// fieldByTag returns the field of the struct from structType for the field
+// called name in the Value
+func fieldByTag(rv reflect.Value, name string) reflect.Value {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("degob") == name {
+			return rv.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// walkValues calls fn with v and everything inside it until fn returns false
+func walkValues(v Value, fn func(Value) bool) bool {
+	if !fn(v) {
+		return false
+	}
+	switch v.Kind() {
+	case Interface:
+		if elem := v.(InterfaceValue).Elem(); elem != nil {
+			return walkValues(elem, fn)
+		}
+	case Struct:
+		for _, f := range v.(StructValue).Fields() {
+			if !walkValues(f.Value, fn) {
+				return false
+			}
+		}
+	case Slice:
+		s := v.(SliceValue)
+		for i := 0; i < s.Len(); i++ {
+			if !walkValues(s.Index(i), fn) {
+				return false
+			}
+		}
+	case Array:
+		a := v.(ArrayValue)
+		for i := 0; i < a.Len(); i++ {
+			if !walkValues(a.Index(i), fn) {
+				return false
+			}
+		}
+	case Map:
+		for _, e := range v.(MapValue).Entries() {
+			if !walkValues(e.Key, fn) || !walkValues(e.Elem, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (ver *verifier) mismatch(p valuePath, v Value, rv reflect.Value) {
+	got := "nothing"
+	if v != nil {
+		got = v.Display(SingleLine)
+	}
+	want := "nothing"
+	if rv.IsValid() {
+		want = fmt.Sprintf("%v", rv.Interface())
+	}
+	ver.mismatches = append(ver.mismatches, Mismatch{
+		Gob:         ver.gob,
+		Path:        p.String(),
+		Degob:       got,
+		EncodingGob: want,
+	})
+}
+
+// compare records every difference between v and rv
+func (ver *verifier) compare(p valuePath, v Value, rv reflect.Value) {
+	if !ver.equal(p, v, rv, true) {
+		ver.mismatch(p, v, rv)
+	}
+}
+
+// equal reports whether v and rv are the same. If record is set the
+// differences inside structs, slices, arrays and maps are recorded where they
+// are and the container itself counts as equal.
+func (ver *verifier) equal(p valuePath, v Value, rv reflect.Value, record bool) bool {
+	if v == nil || !rv.IsValid() {
+		return v == nil && !rv.IsValid()
+	}
+	if rv.Kind() == reflect.Interface {
+		if v.Kind() != Interface {
+			return false
+		}
+		elem := v.(InterfaceValue).Elem()
+		if rv.IsNil() {
+			return elem == nil || elem.Kind() == Nil
+		}
+		inner := rv.Elem()
+		if inner.Kind() == reflect.Ptr {
+			inner = inner.Elem()
+		}
+		return ver.equal(p, elem, inner, record)
+	}
+	switch v.Kind() {
+	case Bool:
+		return rv.Kind() == reflect.Bool && rv.Bool() == v.(BoolValue).Bool()
+	case Int:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int() == v.(IntValue).Int()
+		}
+	case Uint:
+		switch rv.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return rv.Uint() == v.(UintValue).Uint()
+		}
+	case Float:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return sameFloat(rv.Float(), v.(FloatValue).Float())
+		}
+	case Complex:
+		switch rv.Kind() {
+		case reflect.Complex64, reflect.Complex128:
+			c, d := rv.Complex(), v.(ComplexValue).Complex()
+			return sameFloat(real(c), real(d)) && sameFloat(imag(c), imag(d))
+		}
+	case String:
+		return rv.Kind() == reflect.String && rv.String() == v.(StringValue).String()
+	case Bytes:
+		return rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 &&
+			bytes.Equal(rv.Bytes(), v.(BytesValue).Bytes())
+	case Struct:
+		if rv.Kind() != reflect.Struct {
+			return false
+		}
+		for _, f := range v.(StructValue).Fields() {
+			rf := fieldByTag(rv, f.Name)
+			if !rf.IsValid() {
+				// it couldn't be built
+				continue
+			}
+			fp := append(p[:len(p):len(p)], pathElem{field: f.Name})
+			if !ver.equal(fp, f.Value, rf, record) {
+				if !record {
+					return false
+				}
+				ver.mismatch(fp, f.Value, rf)
+			}
+		}
+		return true
+	case Slice, Array:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return false
+		}
+		var n int
+		var index func(int) Value
+		if s, ok := v.(SliceValue); ok {
+			n, index = s.Len(), s.Index
+		} else {
+			a := v.(ArrayValue)
+			n, index = a.Len(), a.Index
+		}
+		if n != rv.Len() {
+			return false
+		}
+		for i := 0; i < n; i++ {
+			ip := append(p[:len(p):len(p)], pathElem{index: fmt.Sprint(i)})
+			if !ver.equal(ip, index(i), rv.Index(i), record) {
+				if !record {
+					return false
+				}
+				ver.mismatch(ip, index(i), rv.Index(i))
+			}
+		}
+		return true
+	case Map:
+		entries := v.(MapValue).Entries()
+		if rv.Kind() != reflect.Map || rv.Len() != len(entries) {
+			return false
+		}
+		for _, e := range entries {
+			kp := append(p[:len(p):len(p)], pathElem{index: e.Key.Display(SingleLine)})
+			key, ok := ver.findKey(e.Key, rv)
+			if !ok {
+				if !record {
+					return false
+				}
+				ver.mismatch(kp, e.Key, reflect.Value{})
+				continue
+			}
+			if !ver.equal(kp, e.Elem, rv.MapIndex(key), record) {
+				if !record {
+					return false
+				}
+				ver.mismatch(kp, e.Elem, rv.MapIndex(key))
+			}
+		}
+		return true
+	case Opaque:
+		// opaque fields aren't built so there is nothing to compare
+		return true
+	case Nil:
+		return (rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr ||
+			rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil()
+	}
+	return false
+}
+
+// sameFloat is == except that NaNs are the same as each other
+func sameFloat(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// maps can have keys that aren't comparable with == once they are values so
+// they are looked for one by one
+func (ver *verifier) findKey(k Value, rv reflect.Value) (reflect.Value, bool) {
+	iter := rv.MapRange()
+	for iter.Next() {
+		if ver.equal(nil, k, iter.Key(), false) {
+			return iter.Key(), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,169 @@
+package degob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type verifyInner struct {
+	N int8
+	B []byte
+}
+
+type verifySample struct {
+	Name  string
+	Inner verifyInner
+	Ptr   *verifyInner
+	List  []verifyInner
+	Grid  [2][2]uint16
+	Index map[string]float32
+	Z     complex64
+	Any   interface{}
+}
+
+func TestVerify(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []interface{}{
+		verifySample{
+			Name:  "full",
+			Inner: verifyInner{N: -3, B: []byte("abc")},
+			Ptr:   &verifyInner{N: 4},
+			List:  []verifyInner{{N: 1}, {B: []byte{0}}},
+			Grid:  [2][2]uint16{{1, 2}, {3}},
+			Index: map[string]float32{"a": 1.5, "b": -2},
+			Z:     complex(1, -1),
+			Any:   7,
+		},
+		verifySample{},
+		[]string{"x", "y"},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := Verify(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range res.Skipped {
+		t.Errorf("skipped gob %d: %v", i+1, err)
+	}
+	for _, m := range res.Mismatches {
+		t.Error(m)
+	}
+	if res.Checked != 3 {
+		t.Fatalf("expected 3 gobs to be checked got %d", res.Checked)
+	}
+}
+
+// VerifyRegistering registers names with encoding/gob for the rest of the
+// process, so it gets a test binary of its own
+func TestVerifyRegistering(t *testing.T) {
+	if os.Getenv("DEGOB_TEST_REGISTERING") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestVerifyRegistering$")
+		cmd.Env = append(os.Environ(), "DEGOB_TEST_REGISTERING=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v:\n%s", err, out)
+		}
+		return
+	}
+	files, err := filepath.Glob(filepath.Join("test_examples", "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := VerifyRegistering(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		for i, err := range res.Skipped {
+			t.Errorf("%s: skipped gob %d: %v", f, i+1, err)
+		}
+		for _, m := range res.Mismatches {
+			t.Errorf("%s: %s", f, m)
+		}
+	}
+
+	// map entries are found by key and interfaces are looked through
+	var buf bytes.Buffer
+	fileToBufferTest("interfacemap.bin", &buf, t)
+	gobs := decodeFileTest("interfacemap.bin", t)
+	if err := gobs[0].SetExpr(`["StringToInt"]=13`); err != nil {
+		t.Fatal(err)
+	}
+	res, err := verifyGobs(buf.Bytes(), gobs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatches := res.Mismatches
+	if len(mismatches) != 1 || mismatches[0].Path != `["StringToInt"]` {
+		t.Fatalf("expected a mismatch at [\"StringToInt\"] but got %v", mismatches)
+	}
+}
+
+type verifyNaN struct {
+	F float64
+	C complex128
+	S []float32
+}
+
+func TestVerifyNaN(t *testing.T) {
+	nan := math.NaN()
+	b := encodeTest(t, verifyNaN{F: nan, C: complex(1, nan), S: []float32{float32(nan), 2}})
+	res, err := Verify(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 1 || len(res.Mismatches) != 0 {
+		t.Fatalf("expected NaNs to match but got %+v", res)
+	}
+}
+
+func TestVerifyUnregistered(t *testing.T) {
+	var buf bytes.Buffer
+	fileToBufferTest("interfacemap.bin", &buf, t)
+	res, err := Verify(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 0 || len(res.Skipped) != 1 || len(res.Mismatches) != 0 {
+		t.Fatalf("expected the gob to be skipped but got %+v", res)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	fileToBufferTest("nestedstructfull.bin", &buf, t)
+	raw := buf.Bytes()
+	gobs := decodeFileTest("nestedstructfull.bin", t)
+	if err := gobs[0].SetExpr(".W.C=0x0102030405ff"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gobs[0].SetExpr(".Z=Goodbye"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := verifyGobs(raw, gobs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatches := res.Mismatches
+	var paths []string
+	for _, m := range mismatches {
+		paths = append(paths, m.Path)
+	}
+	cmp(strings.Join(paths, " "), ".W.C .Z", t)
+	cmp(mismatches[1].Degob, `"Goodbye"`, t)
+	cmp(mismatches[1].EncodingGob, "Hello", t)
+}